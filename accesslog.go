@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/netip"
+	"sync/atomic"
+	"time"
+)
+
+// logSampler decides which successful requests the access log keeps. Requests
+// that failed with a 4xx or 5xx are always logged.
+type logSampler struct {
+	// rate keeps 1 in rate successful requests; 1 or less keeps all of them.
+	rate int
+	// random picks the kept requests at random rather than keeping exactly
+	// every rate-th one.
+	random bool
+	n      atomic.Uint64
+}
+
+func (s *logSampler) keep(status int) bool {
+	if s.rate <= 1 || status >= 400 {
+		return true
+	}
+	if s.random {
+		return rand.IntN(s.rate) == 0
+	}
+	return s.n.Add(1)%uint64(s.rate) == 1
+}
+
+// accessLog logs one line per request served by next, with the client address
+// resolved through trustedProxies. Successful requests are thinned out by
+// sampler.
+func accessLog(trustedProxies []netip.Prefix, sampler *logSampler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		if !sampler.keep(sw.status) {
+			return
+		}
+		log.Printf("access client=%s method=%s path=%q proto=%s status=%d bytes=%d duration=%s",
+			clientIP(r, trustedProxies), r.Method, r.URL.Path, r.Proto, sw.status, sw.bytes, time.Since(start))
+	})
+}
+
+// statusWriter records the status code and body size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader && code >= 200 {
+		w.wroteHeader = true
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	w.wroteHeader = true
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
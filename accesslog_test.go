@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// captureLog sends the standard logger's output to the returned buffer
+// until the test ends.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/ok", newFoundHandler("hello", "text/plain"))
+	mux.Handle("/err", unmatchedRoute)
+
+	for _, random := range []bool{false, true} {
+		buf := captureLog(t)
+		h := accessLog(nil, &logSampler{rate: 10, random: random}, mux)
+		for range 1000 {
+			serve(h, http.MethodGet, "/ok")
+		}
+		for range 50 {
+			serve(h, http.MethodGet, "/err")
+		}
+		ok, errs := strings.Count(buf.String(), `path="/ok"`), strings.Count(buf.String(), `path="/err"`)
+		if errs != 50 {
+			t.Errorf("random=%t: logged %d of 50 errors, want all of them", random, errs)
+		}
+		if ok < 50 || ok > 150 {
+			t.Errorf("random=%t: logged %d of 1000 successes, want about 1 in 10", random, ok)
+		}
+		if !random && ok != 100 {
+			t.Errorf("deterministic sampling logged %d of 1000 successes, want exactly 100", ok)
+		}
+	}
+}
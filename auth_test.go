@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireBearerToken(t *testing.T) {
+	h := requireBearerToken("s3cret", newFoundHandler("metrics", "text/plain"))
+	for _, tc := range []struct {
+		authorization string
+		code          int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Basic s3cret", http.StatusUnauthorized},
+		{"Bearer s3cret", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("Authorization %q: got %d, want %d", tc.authorization, rec.Code, tc.code)
+		}
+		if tc.code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Authorization %q: 401 without a WWW-Authenticate challenge", tc.authorization)
+		}
+	}
+}
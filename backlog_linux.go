@@ -0,0 +1,33 @@
+//go:build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setListenBacklog changes the accept queue length of ln to backlog. Go
+// always listens with the system maximum, and calling listen(2) again on a
+// listening socket is how Linux lets it be changed afterwards. The kernel
+// still caps the value at net.core.somaxconn.
+func setListenBacklog(ln net.Listener, backlog int) error {
+	sc, ok := ln.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	err = rc.Control(func(fd uintptr) {
+		listenErr = unix.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	return listenErr
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenBacklog(t *testing.T) {
+	ln, err := listen("tcp", "127.0.0.1:0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if err := setListenBacklog(ln, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing accepts, so once the queue is full Linux drops further
+	// connection attempts and the dials time out.
+	const attempts = 10
+	connected := 0
+	for range attempts {
+		conn, err := net.DialTimeout("tcp", ln.Addr().String(), 100*time.Millisecond)
+		if err != nil {
+			continue
+		}
+		defer conn.Close()
+		connected++
+	}
+	if connected == 0 || connected == attempts {
+		t.Errorf("%d of %d connections made it into a backlog of 1, want some but not all", connected, attempts)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+// setListenBacklog is a no-op outside Linux.
+func setListenBacklog(ln net.Listener, backlog int) error {
+	return nil
+}
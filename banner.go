@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+)
+
+// startupBanner summarises the effective configuration once the app is
+// listening, so operators can confirm it at a glance in the logs.
+type startupBanner struct {
+	Version     string   `json:"version"`
+	Listen      []string `json:"listen"`
+	Protocols   []string `json:"protocols"`
+	MetricsPath string   `json:"metrics_path"`
+	MetricsAuth bool     `json:"metrics_auth"`
+	Admin       bool     `json:"admin"`
+	Chaos       bool     `json:"chaos"`
+	// Limits are the settings bounding the work a request may cause.
+	Limits map[string]any `json:"limits"`
+	// Flags are the flags set on the command line, with secretFlags
+	// redacted.
+	Flags map[string]string `json:"flags"`
+}
+
+// logStartupBanner logs b as a single line of JSON, filling in the flags set
+// in fs.
+func logStartupBanner(b startupBanner, fs *flag.FlagSet) {
+	b.Flags = map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		b.Flags[f.Name] = flagValue(f)
+	})
+	line, err := json.Marshal(b)
+	if err != nil {
+		log.Printf("failed to encode the startup banner: %v", err)
+		return
+	}
+	log.Printf("started %s", line)
+}
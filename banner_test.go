@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStartupBanner(t *testing.T) {
+	buf := captureLog(t)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("bind", ":8080", "")
+	fs.String("metrics-bearer-token", "", "")
+	fs.Parse([]string{"-bind", "127.0.0.1:9090", "-metrics-bearer-token", "s3cret"})
+	logStartupBanner(startupBanner{Listen: []string{"127.0.0.1:9090"}, Protocols: []string{"http/1.1", "h2c"}, MetricsPath: "/metrics", MetricsAuth: true}, fs)
+
+	line, ok := strings.CutPrefix(strings.TrimSpace(buf.String()), "started ")
+	if !ok {
+		t.Fatalf("logged %q, want the banner", buf)
+	}
+	var b startupBanner
+	if err := json.Unmarshal([]byte(line), &b); err != nil {
+		t.Fatalf("banner %s is not JSON: %v", line, err)
+	}
+	if !slices.Equal(b.Listen, []string{"127.0.0.1:9090"}) || !slices.Contains(b.Protocols, "h2c") {
+		t.Errorf("banner lists %v and %v, want the bind address and h2c", b.Listen, b.Protocols)
+	}
+	if b.Flags["bind"] != "127.0.0.1:9090" || b.Flags["metrics-bearer-token"] == "s3cret" {
+		t.Errorf("banner flags are %v, want -bind and a redacted token", b.Flags)
+	}
+}
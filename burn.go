@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// burnPeriod is the length of one busy-then-idle cycle. It is short enough
+// for the load to look steady at typical scrape and top refresh intervals.
+const burnPeriod = 100 * time.Millisecond
+
+// burnSummary is the JSON body returned by /burn.
+type burnSummary struct {
+	Percent        int     `json:"percent"`
+	Seconds        int     `json:"seconds"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	// AchievedPercent is the share of the elapsed time spent busy.
+	AchievedPercent float64 `json:"achieved_percent"`
+}
+
+// newBurnHandler returns the handler for /burn/{percent}/{seconds}, which
+// keeps one core approximately percent busy for seconds by alternating
+// between spinning and sleeping within each burnPeriod. Unlike /load it shows
+// partial utilisation rather than a pinned core.
+func newBurnHandler(maxDuration time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		percent, err := strconv.Atoi(r.PathValue("percent"))
+		if err != nil || percent < 0 || percent > 100 {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: "percent must be an integer between 0 and 100"})
+			return
+		}
+		seconds, err := strconv.Atoi(r.PathValue("seconds"))
+		if err != nil || seconds < 0 {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: "seconds must be a non-negative integer"})
+			return
+		}
+		if d := time.Duration(seconds) * time.Second; d > maxDuration {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("seconds must not exceed %d", int(maxDuration.Seconds()))})
+			return
+		}
+
+		ctx := r.Context()
+		busy := burnPeriod * time.Duration(percent) / 100
+		start := time.Now()
+		deadline := start.Add(time.Duration(seconds) * time.Second)
+		var spent time.Duration
+		for now := start; now.Before(deadline); now = time.Now() {
+			if burnCPU(ctx, min(busy, deadline.Sub(now))) != nil {
+				return
+			}
+			spent += time.Since(now)
+			if sleepContext(ctx, min(burnPeriod-busy, time.Until(deadline))) != nil {
+				return
+			}
+		}
+
+		elapsed := time.Since(start)
+		achieved := 0.0
+		if elapsed > 0 {
+			achieved = float64(spent) / float64(elapsed) * 100
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(burnSummary{
+			Percent:         percent,
+			Seconds:         seconds,
+			ElapsedSeconds:  elapsed.Seconds(),
+			AchievedPercent: achieved,
+		})
+	})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBurn(t *testing.T) {
+	if testing.Short() {
+		t.Skip("burns CPU for a second")
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/burn/{percent}/{seconds}", newBurnHandler(time.Minute))
+
+	rec := serve(mux, http.MethodGet, "/burn/30/1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var summary burnSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.ElapsedSeconds < 1 || summary.ElapsedSeconds > 1.5 {
+		t.Errorf("ran for %vs, want about the 1s requested", summary.ElapsedSeconds)
+	}
+	if summary.AchievedPercent < 10 || summary.AchievedPercent > 60 {
+		t.Errorf("was busy %v%% of the time, want about 30%% and well below 100%%", summary.AchievedPercent)
+	}
+
+	for _, target := range []string{"/burn/101/1", "/burn/-1/1", "/burn/50/61"} {
+		if rec := serve(mux, http.MethodGet, target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", target, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// simulateOrders feeds orders_total and order_value_dollars with made-up
+// orders every interval until ctx is done, so that dashboards have domain
+// metrics next to the HTTP ones to work with.
+func simulateOrders(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for range rand.IntN(5) {
+			ordersTotal.Inc()
+			// Log-normal order values cluster around $40 with a long tail of
+			// big orders, which looks more like real shopping than uniform noise.
+			orderValueDollars.Observe(math.Round(math.Exp(3.7+0.8*rand.NormFloat64())*100) / 100)
+		}
+	}
+}
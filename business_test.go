@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSimulateOrders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	orders, values := testutil.ToFloat64(ordersTotal), histogramOf(t, orderValueDollars).GetSampleCount()
+	go simulateOrders(ctx, time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(ordersTotal) == orders || histogramOf(t, orderValueDollars).GetSampleCount() == values {
+		if time.Now().After(deadline) {
+			t.Fatal("orders_total and order_value_dollars did not advance")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The label values of the request metrics that are not known up front are
+// estimated from what a typical handler sees.
+const (
+	assumedCodesPerHandler   = 4 // e.g. 200, 400, 404 and 503
+	assumedMethodsPerHandler = 2 // e.g. GET and HEAD
+	assumedProtos            = 3 // HTTP/1.1, HTTP/2.0 and HTTP/3.0
+)
+
+// seriesEstimate is the estimated number of series of one metric.
+type seriesEstimate struct {
+	metric string
+	series int
+}
+
+// estimateRequestSeries estimates the series of the per-request metrics as
+// the cross-product of their label value sets, with one series per bucket of
+// each histogram plus its _sum and _count. It deliberately only covers
+// metrics whose labels are bounded; labels such as raw paths or user agents
+// would make any estimate meaningless and must not be added in the first
+// place.
+func estimateRequestSeries(handlers, sizeBuckets int) []seriesEstimate {
+	perHandler := assumedCodesPerHandler * assumedMethodsPerHandler
+	estimates := []seriesEstimate{
+		{"http_requests_total", assumedCodesPerHandler * assumedMethodsPerHandler * assumedProtos * 2},
+		{"http_request_duration_seconds", handlers * perHandler * (len(prometheus.DefBuckets) + 2)},
+		{"http_response_size_bytes", handlers * perHandler * (sizeBuckets + 2)},
+		{"http_size_ratio", handlers * (8 + 2)},
+		{"http_requests_timed_out_total", handlers},
+		{"http_requests_by_agent_total", len(userAgentClasses)},
+	}
+	sort.Slice(estimates, func(i, j int) bool { return estimates[i].series > estimates[j].series })
+	return estimates
+}
+
+// checkCardinality warns when the estimated series of the request metrics
+// exceed limit, or returns an error if strict is set. A limit of 0 disables
+// the check.
+func checkCardinality(estimates []seriesEstimate, limit int, strict bool) error {
+	if limit <= 0 {
+		return nil
+	}
+	total := 0
+	for _, e := range estimates {
+		total += e.series
+	}
+	if total <= limit {
+		return nil
+	}
+	msg := fmt.Sprintf("the request metrics are estimated to grow to %d series, above -cardinality-limit %d; the largest is %s with %d",
+		total, limit, estimates[0].metric, estimates[0].series)
+	if strict {
+		return errors.New(msg)
+	}
+	log.Printf("warning: %s. Consider disabling endpoints or using fewer -response-size-buckets.", msg)
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckCardinality(t *testing.T) {
+	// Many handlers and response size buckets make the size histogram the
+	// largest.
+	estimates := estimateRequestSeries(100, 20)
+	for _, tc := range []struct {
+		limit        int
+		strict, warn bool
+		fail         bool
+	}{
+		{limit: 0},                              // disabled
+		{limit: 1 << 30},                        // within the limit
+		{limit: 1000, warn: true},               // over it, warned about
+		{limit: 1000, strict: true, fail: true}, // over it with -strict-cardinality
+	} {
+		buf := captureLog(t)
+		err := checkCardinality(estimates, tc.limit, tc.strict)
+		if (err != nil) != tc.fail {
+			t.Errorf("limit %d, strict %t: got error %v, want one: %t", tc.limit, tc.strict, err, tc.fail)
+		}
+		if warned := strings.Contains(buf.String(), "warning:"); warned != tc.warn {
+			t.Errorf("limit %d, strict %t: warned %t, want %t", tc.limit, tc.strict, warned, tc.warn)
+		}
+		if err != nil && !strings.Contains(err.Error(), "http_response_size_bytes") {
+			t.Errorf("error %q does not name the largest metric", err)
+		}
+	}
+}
+
+// TestBoundedLabels catches labels whose values would grow without bound,
+// which must never be added to the app's metrics.
+func TestBoundedLabels(t *testing.T) {
+	mfs, err := newTestRegistry(t).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unbounded := map[string]bool{"path": true, "url": true, "uri": true, "client": true, "ip": true, "remote_addr": true, "user_agent_raw": true}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if unbounded[l.GetName()] {
+					t.Errorf("%s has the unbounded label %s", mf.GetName(), l.GetName())
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parsePrefixes([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name, remoteAddr, xff, realIP, want string
+	}{
+		{"untrusted peer ignores X-Forwarded-For", "203.0.113.7:1234", "198.51.100.1", "", "203.0.113.7"},
+		{"untrusted peer ignores X-Real-IP", "203.0.113.7:1234", "", "198.51.100.1", "203.0.113.7"},
+		{"trusted peer", "10.1.2.3:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"trusted single host", "192.0.2.1:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"spoofed hop left of the client", "10.1.2.3:1234", "1.2.3.4, 198.51.100.1, 10.9.9.9", "", "198.51.100.1"},
+		{"trusted peer with X-Real-IP", "10.1.2.3:1234", "", "198.51.100.1", "198.51.100.1"},
+		{"trusted peer without headers", "10.1.2.3:1234", "", "", "10.1.2.3"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remoteAddr
+		if tc.xff != "" {
+			r.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if tc.realIP != "" {
+			r.Header.Set("X-Real-IP", tc.realIP)
+		}
+		if got := clientIP(r, proxies); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := parsePrefixes([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("parsed 10.0.0.0/33 as a trusted proxy")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// secretFlags are reported by /admin/config and the startup banner only as
+// whether they are set.
+var secretFlags = map[string]bool{
+	"metrics-bearer-token": true,
+}
+
+// newConfigHandler serves /admin/config: the effective value of every flag in
+// fs, keyed by flag name, so operators can check what a running instance was
+// started with.
+func newConfigHandler(fs *flag.FlagSet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := map[string]string{}
+		fs.VisitAll(func(f *flag.Flag) {
+			config[f.Name] = flagValue(f)
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(config)
+	})
+}
+
+// flagValue returns the value of f for display, hiding secretFlags.
+func flagValue(f *flag.Flag) string {
+	v := f.Value.String()
+	if secretFlags[f.Name] && v != "" {
+		v = "redacted"
+	}
+	return v
+}
+
+// configValue is a numeric setting exposed as a config_* gauge.
+type configValue struct {
+	name  string
+	flag  string
+	value float64
+}
+
+// configGauges returns a constant gauge per setting, named config_<name>, so
+// dashboards can line up behaviour changes with configuration changes.
+func configGauges(values []configValue) []prometheus.Collector {
+	gauges := make([]prometheus.Collector, 0, len(values))
+	for _, v := range values {
+		g := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "config_" + v.name,
+			Help: "Configured value of -" + v.flag,
+		})
+		g.Set(v.value)
+		gauges = append(gauges, g)
+	}
+	return gauges
+}
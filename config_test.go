@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConfigHandler(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("max-header-bytes", 1<<20, "")
+	fs.String("metrics-bearer-token", "", "")
+	fs.Parse([]string{"-max-header-bytes", "2048", "-metrics-bearer-token", "s3cret"})
+
+	var config map[string]string
+	if err := json.Unmarshal(serve(newConfigHandler(fs), http.MethodGet, "/admin/config").Body.Bytes(), &config); err != nil {
+		t.Fatal(err)
+	}
+	if got := config["max-header-bytes"]; got != "2048" {
+		t.Errorf("max-header-bytes = %q, want 2048", got)
+	}
+	if got := config["metrics-bearer-token"]; got != "redacted" {
+		t.Errorf("metrics-bearer-token = %q, want it redacted", got)
+	}
+}
+
+func TestConfigGauges(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(configGauges([]configValue{
+		{"request_timeout_seconds", "request-timeout", (1500 * time.Millisecond).Seconds()},
+		{"max_inflight", "max-inflight", 64},
+	})...)
+	want := `
+# HELP config_max_inflight Configured value of -max-inflight
+# TYPE config_max_inflight gauge
+config_max_inflight 64
+# HELP config_request_timeout_seconds Configured value of -request-timeout
+# TYPE config_request_timeout_seconds gauge
+config_request_timeout_seconds 1.5
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// connTracker follows every connection through the http.Server connection
+// states in the http_connections gauge and http_connection_states_total
+// counter. net/http stops reporting on connections once they are hijacked,
+// which is how h2c takes them over, so the listener is wrapped as well to
+// see those connections close.
+type connTracker struct {
+	mu     sync.Mutex
+	states map[net.Conn]http.ConnState
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{states: map[net.Conn]http.ConnState{}}
+}
+
+// listener wraps ln so that the tracker sees hijacked connections close.
+func (t *connTracker) listener(ln net.Listener) net.Listener {
+	return trackedListener{Listener: ln, t: t}
+}
+
+// connState implements http.Server.ConnState.
+func (t *connTracker) connState(c net.Conn, state http.ConnState) {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.transition(c, state)
+}
+
+// closed is called when a connection accepted from the wrapped listener is
+// closed. Only hijacked connections are still tracked at that point; net/http
+// has already reported the others as closed.
+func (t *connTracker) closed(c net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.states[c] == http.StateHijacked {
+		t.transition(c, http.StateClosed)
+	}
+}
+
+func (t *connTracker) transition(c net.Conn, state http.ConnState) {
+	httpConnectionStatesTotal.WithLabelValues(state.String()).Inc()
+	if prev, ok := t.states[c]; ok {
+		httpConnections.WithLabelValues(prev.String()).Dec()
+	}
+	if state == http.StateClosed {
+		delete(t.states, c)
+		return
+	}
+	t.states[c] = state
+	httpConnections.WithLabelValues(state.String()).Inc()
+}
+
+type trackedListener struct {
+	net.Listener
+	t *connTracker
+}
+
+func (l trackedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &trackedConn{Conn: c, t: l.t}, nil
+}
+
+type trackedConn struct {
+	net.Conn
+	t    *connTracker
+	once sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { c.t.closed(c) })
+	return err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConnStates(t *testing.T) {
+	tracker := newConnTracker()
+	ts := httptest.NewUnstartedServer(newFoundHandler("hello", "text/plain"))
+	ts.Config.ConnState = tracker.connState
+	ts.Listener = tracker.listener(ts.Listener)
+	ts.Start()
+	defer ts.Close()
+
+	states := []string{"new", "active", "idle", "closed"}
+	before := map[string]float64{}
+	for _, s := range states {
+		before[s] = testutil.ToFloat64(httpConnectionStatesTotal.WithLabelValues(s))
+	}
+	// Without the cap, a second connection is dialed if the first is not
+	// back in the idle pool by the time of the second request.
+	client := ts.Client()
+	client.Transport.(*http.Transport).MaxConnsPerHost = 1
+	for range 2 {
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	client.CloseIdleConnections()
+
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(httpConnectionStatesTotal.WithLabelValues("closed")) == before["closed"] {
+		if time.Now().After(deadline) {
+			t.Fatal("the connection was not reported as closed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Both requests reuse one kept-alive connection.
+	for s, want := range map[string]float64{"new": 1, "active": 2, "idle": 2, "closed": 1} {
+		if got := testutil.ToFloat64(httpConnectionStatesTotal.WithLabelValues(s)) - before[s]; got != want {
+			t.Errorf("http_connection_states_total{state=%q} increased by %v, want %v", s, got, want)
+		}
+	}
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if n := len(tracker.states); n != 0 {
+		t.Errorf("still tracking %d connections after they closed", n)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var errPoolTimeout = errors.New("timed out waiting for a database connection")
+
+// dbPool simulates a database connection pool holding a fixed number of
+// connections, represented by slots in a buffered channel.
+type dbPool struct {
+	conns       chan struct{}
+	waitTimeout time.Duration
+}
+
+func newDBPool(size int, waitTimeout time.Duration) *dbPool {
+	return &dbPool{conns: make(chan struct{}, size), waitTimeout: waitTimeout}
+}
+
+// acquire takes a connection from the pool. When all connections are in use it
+// queues for at most p.waitTimeout before giving up with errPoolTimeout.
+func (p *dbPool) acquire(ctx context.Context) error {
+	select {
+	case p.conns <- struct{}{}:
+		dbPoolInUse.Inc()
+		return nil
+	default:
+	}
+
+	dbPoolWaiters.Inc()
+	defer dbPoolWaiters.Dec()
+	timer := time.NewTimer(p.waitTimeout)
+	defer timer.Stop()
+	select {
+	case p.conns <- struct{}{}:
+		dbPoolInUse.Inc()
+		return nil
+	case <-timer.C:
+		return errPoolTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release returns a connection taken with acquire to the pool.
+func (p *dbPool) release() {
+	<-p.conns
+	dbPoolInUse.Dec()
+}
+
+// newDBQueryHandler returns the handler for /db-query/{ms}, which simulates a
+// query taking ms milliseconds on a connection from pool. Once the pool is
+// saturated requests queue for a connection and eventually fail with 503.
+func newDBQueryHandler(pool *dbPool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ms, err := strconv.Atoi(r.PathValue("ms"))
+		if err != nil || ms < 0 {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: "ms must be a non-negative integer"})
+			return
+		}
+
+		start := time.Now()
+		if err := pool.acquire(r.Context()); err != nil {
+			if errors.Is(err, errPoolTimeout) {
+				writeError(w, apiError{Code: http.StatusServiceUnavailable, Message: err.Error()})
+			}
+			return
+		}
+		err = sleepContext(r.Context(), time.Duration(ms)*time.Millisecond)
+		pool.release()
+		dbQueryDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Query took " + strconv.Itoa(ms) + " milliseconds."))
+	})
+}
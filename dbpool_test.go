@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDBPoolSaturated(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/db-query/{ms}", newDBQueryHandler(newDBPool(1, 100*time.Millisecond)))
+	holding := make(chan int)
+	go func() { holding <- serve(mux, http.MethodGet, "/db-query/300").Code }()
+	for testutil.ToFloat64(dbPoolInUse) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	waiting := make(chan int)
+	go func() { waiting <- serve(mux, http.MethodGet, "/db-query/0").Code }()
+	sawWaiter := false
+	for !sawWaiter {
+		select {
+		case code := <-waiting:
+			t.Fatalf("the query on a saturated pool answered %d without waiting", code)
+		default:
+			sawWaiter = testutil.ToFloat64(dbPoolWaiters) == 1
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if code := <-waiting; code != http.StatusServiceUnavailable {
+		t.Errorf("the query that timed out waiting answered %d, want 503", code)
+	}
+	if code := <-holding; code != http.StatusOK {
+		t.Errorf("the query holding the connection answered %d, want 200", code)
+	}
+	if n := testutil.ToFloat64(dbPoolWaiters); n != 0 {
+		t.Errorf("db_pool_waiters = %v once nothing waits, want 0", n)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// deadlineUnit is how long one unit of /deadline work takes.
+const deadlineUnit = 10 * time.Millisecond
+
+// deadlineSummary is the JSON body returned by /deadline.
+type deadlineSummary struct {
+	RequestedUnits   int    `json:"requested_units"`
+	CompletedUnits   int    `json:"completed_units"`
+	Deadline         string `json:"deadline,omitempty"`
+	DeadlineExceeded bool   `json:"deadline_exceeded"`
+}
+
+// newDeadlineHandler returns the handler for /deadline, a worked example of a
+// deadline-aware handler. It does up to ?units=N units of work of
+// deadlineUnit each, 100 by default, and checks the request context between
+// units. A deadline is set from the X-Request-Timeout header, a Go duration
+// such as 250ms, if the client sends one. When the deadline passes the
+// handler stops and still answers 200 with the units it managed, since a
+// partial result is more useful to the caller than an error.
+func newDeadlineHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		units := 100
+		if s := r.URL.Query().Get("units"); s != "" {
+			var err error
+			if units, err = strconv.Atoi(s); err != nil || units < 0 {
+				writeError(w, apiError{Code: http.StatusBadRequest, Message: "units must be a non-negative integer"})
+				return
+			}
+		}
+		ctx := r.Context()
+		if s := r.Header.Get("X-Request-Timeout"); s != "" {
+			timeout, err := time.ParseDuration(s)
+			if err != nil || timeout <= 0 {
+				writeError(w, apiError{Code: http.StatusBadRequest, Message: "X-Request-Timeout must be a positive duration such as 250ms"})
+				return
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		summary := deadlineSummary{RequestedUnits: units}
+		if deadline, ok := ctx.Deadline(); ok {
+			summary.Deadline = deadline.Format(time.RFC3339Nano)
+		}
+		for range units {
+			if sleepContext(ctx, deadlineUnit) != nil {
+				break
+			}
+			summary.CompletedUnits++
+		}
+		if r.Context().Err() != nil {
+			return // the client went away, nobody is left to answer
+		}
+		summary.DeadlineExceeded = ctx.Err() == context.DeadlineExceeded
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summary)
+	})
+}
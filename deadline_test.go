@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeadlinePartialResult(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/deadline?units=50", nil)
+	req.Header.Set("X-Request-Timeout", "55ms")
+	rec := httptest.NewRecorder()
+	newDeadlineHandler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var summary deadlineSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if !summary.DeadlineExceeded || summary.Deadline == "" {
+		t.Errorf("got %+v, want the deadline reported as exceeded", summary)
+	}
+	if summary.CompletedUnits < 1 || summary.CompletedUnits >= summary.RequestedUnits {
+		t.Errorf("completed %d of %d units, want a partial result", summary.CompletedUnits, summary.RequestedUnits)
+	}
+
+	rec = serve(newDeadlineHandler(), http.MethodGet, "/deadline?units=2")
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.DeadlineExceeded || summary.CompletedUnits != 2 {
+		t.Errorf("without a deadline: got %+v, want both units done", summary)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxDeadlockStall bounds how long /deadlock/{ms} may stall.
+const maxDeadlockStall = time.Minute
+
+// lockOrdering holds the two mutexes behind /deadlock/{ms}. They are shared by
+// all requests, so concurrent requests queue behind each other just like
+// requests stuck behind a real lock-ordering bug.
+type lockOrdering struct {
+	a, b sync.Mutex
+}
+
+// deadlockHandler serves /deadlock/{ms}. A background goroutine takes b and
+// holds it for ms, as if it were waiting to take a in the opposite order, while
+// the request takes a and then blocks on b. Unlike a true deadlock the holder
+// gives up after ms, so the stall resolves itself. Mutexes cannot be
+// interrupted, so the request keeps waiting even if the client goes away.
+func (l *lockOrdering) deadlockHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ms, err := strconv.Atoi(r.PathValue("ms"))
+		if err != nil || ms < 0 {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: "ms must be a non-negative integer"})
+			return
+		}
+		stall := time.Duration(ms) * time.Millisecond
+		if stall > maxDeadlockStall {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("ms must not exceed %d", maxDeadlockStall.Milliseconds())})
+			return
+		}
+
+		start := time.Now()
+		held := make(chan struct{})
+		go func() {
+			l.b.Lock()
+			close(held)
+			time.Sleep(stall)
+			l.b.Unlock()
+		}()
+		<-held
+		l.a.Lock()
+		l.b.Lock()
+		l.b.Unlock()
+		l.a.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			StalledSeconds float64 `json:"stalled_seconds"`
+		}{time.Since(start).Seconds()})
+	})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDeadlockStall(t *testing.T) {
+	var l lockOrdering
+	mux := http.NewServeMux()
+	mux.Handle("/deadlock/{ms}", l.deadlockHandler())
+
+	start := time.Now()
+	rec := serve(mux, http.MethodGet, "/deadlock/100")
+	elapsed := time.Since(start)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	if elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("returned after %s, want about the 100ms stall", elapsed)
+	}
+	var body struct {
+		StalledSeconds float64 `json:"stalled_seconds"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.StalledSeconds < 0.1 || body.StalledSeconds > elapsed.Seconds() {
+		t.Errorf("reported a stall of %vs, want between 0.1s and the %s the request took", body.StalledSeconds, elapsed)
+	}
+
+	if rec := serve(mux, http.MethodGet, "/deadlock/60001"); rec.Code != http.StatusBadRequest {
+		t.Errorf("a stall above the maximum: got %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// dnsLookupResult is the JSON body returned by /dns-lookup/{host}.
+type dnsLookupResult struct {
+	Host            string   `json:"host"`
+	Addresses       []string `json:"addresses"`
+	DurationSeconds float64  `json:"duration_seconds"`
+}
+
+// newDNSLookupHandler returns the handler for /dns-lookup/{host}, which
+// resolves host with the default resolver and reports the addresses and how
+// long the lookup took. Only hosts on allowlist may be looked up, so the
+// endpoint cannot be used to probe arbitrary names; an entry starting with
+// "*." allows every subdomain of the rest.
+func newDNSLookupHandler(allowlist []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.ToLower(strings.TrimSuffix(r.PathValue("host"), "."))
+		if !hostAllowed(host, allowlist) {
+			writeError(w, apiError{Code: http.StatusForbidden, Message: "host " + host + " is not in -dns-lookup-allow"})
+			return
+		}
+		start := time.Now()
+		addrs, err := net.DefaultResolver.LookupHost(r.Context(), host)
+		elapsed := time.Since(start)
+		if err != nil {
+			dnsLookupDuration.WithLabelValues("error").Observe(elapsed.Seconds())
+			if r.Context().Err() != nil {
+				return // the client went away, nobody is left to answer
+			}
+			writeError(w, apiError{Code: http.StatusBadGateway, Message: err.Error()})
+			return
+		}
+		dnsLookupDuration.WithLabelValues("success").Observe(elapsed.Seconds())
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dnsLookupResult{Host: host, Addresses: addrs, DurationSeconds: elapsed.Seconds()})
+	})
+}
+
+func hostAllowed(host string, allowlist []string) bool {
+	for _, allowed := range allowlist {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
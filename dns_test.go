@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestDNSLookup(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/dns-lookup/{host}", newDNSLookupHandler([]string{"localhost", "*.example.com"}))
+
+	before := histogramOf(t, dnsLookupDuration.WithLabelValues("success")).GetSampleCount()
+	rec := serve(mux, http.MethodGet, "/dns-lookup/localhost")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var res dnsLookupResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Host != "localhost" || len(res.Addresses) == 0 {
+		t.Errorf("got %+v, want localhost resolved to at least one address", res)
+	}
+	if n := histogramOf(t, dnsLookupDuration.WithLabelValues("success")).GetSampleCount() - before; n != 1 {
+		t.Errorf("dns_lookup_duration_seconds observed %d successful lookups, want 1", n)
+	}
+
+	for host, allowed := range map[string]bool{"localhost": true, "www.example.com": true, "example.com": false, "evil.test": false} {
+		if got := hostAllowed(host, []string{"localhost", "*.example.com"}); got != allowed {
+			t.Errorf("hostAllowed(%q) = %t, want %t", host, got, allowed)
+		}
+	}
+	if rec := serve(mux, http.MethodGet, "/dns-lookup/evil.test"); rec.Code != http.StatusForbidden {
+		t.Errorf("host not on the allowlist: got %d, want 403", rec.Code)
+	}
+}
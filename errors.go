@@ -0,0 +1,24 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// apiError describes why a request was rejected. Handlers report it with
+// writeError so that clients get the same error shape from every endpoint.
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeError responds with err.Code and a JSON body of the form
+// {"error":{"code":...,"message":...}}.
+func writeError(w http.ResponseWriter, err apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(err.Code)
+	json.NewEncoder(w).Encode(struct {
+		Error apiError `json:"error"`
+	}{err})
+}
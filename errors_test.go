@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorResponses(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/", unmatchedRoute)
+	mux.Handle("/payload/{bytes}", newPayloadHandler(10))
+	mux.Handle("/redirect/{code}", newRedirectHandler())
+	for _, tc := range []struct {
+		target string
+		code   int
+	}{
+		{"/no-such-path", http.StatusNotFound},
+		{"/payload/11", http.StatusBadRequest},
+		{"/payload/-1", http.StatusBadRequest},
+		{"/redirect/200", http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%s: got %d, want %d", tc.target, rec.Code, tc.code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: Content-Type = %q, want application/json", tc.target, ct)
+		}
+		var body struct {
+			Error *apiError `json:"error"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error == nil {
+			t.Errorf("%s: body %q is not an error object: %v", tc.target, rec.Body, err)
+			continue
+		}
+		if body.Error.Code != tc.code || body.Error.Message == "" {
+			t.Errorf("%s: got error %+v, want code %d and a message", tc.target, *body.Error, tc.code)
+		}
+	}
+}
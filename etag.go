@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// withETag gathers from g once per request, serves the result through the
+// handler that serve builds for it, and tags the response with an ETag, so
+// clients and caching proxies can revalidate with If-None-Match and get a 304
+// when nothing changed. Last-Modified is when the ETag last changed.
+//
+// The ETag is computed from the gathered families rather than the body, so
+// that the families named in volatile can be left out: metrics that change
+// because they are scraped, such as metrics_gather_duration_seconds, would
+// otherwise give every scrape a new ETag. The Content-Type and
+// Content-Encoding of the response are part of the ETag, as each format is a
+// different representation.
+func withETag(g prometheus.Gatherer, volatile []string, serve func(prometheus.Gatherer) http.Handler) http.Handler {
+	var (
+		mu           sync.Mutex
+		lastETag     string
+		lastModified time.Time
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mfs, err := g.Gather()
+		bw := &bufferedWriter{header: http.Header{}, status: http.StatusOK}
+		serve(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, err })).ServeHTTP(bw, r)
+
+		h := w.Header()
+		for k, v := range bw.header {
+			h[k] = v
+		}
+		if bw.status != http.StatusOK {
+			w.WriteHeader(bw.status)
+			w.Write(bw.body.Bytes())
+			return
+		}
+		hasher := sha256.New()
+		fmt.Fprintf(hasher, "%s\n%s\n", bw.header.Get("Content-Type"), bw.header.Get("Content-Encoding"))
+		for _, mf := range mfs {
+			if !slices.Contains(volatile, mf.GetName()) {
+				expfmt.MetricFamilyToText(hasher, mf)
+			}
+		}
+		etag := `"` + hex.EncodeToString(hasher.Sum(nil)[:16]) + `"`
+		mu.Lock()
+		if etag != lastETag {
+			lastETag, lastModified = etag, time.Now()
+		}
+		modified := lastModified
+		mu.Unlock()
+
+		h.Set("ETag", etag)
+		h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			h.Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(bw.status)
+		w.Write(bw.body.Bytes())
+	})
+}
+
+// etagMatches reports whether the If-None-Match header value matches etag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedWriter holds a whole response in memory.
+type bufferedWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) Header() http.Header         { return w.header }
+func (w *bufferedWriter) WriteHeader(code int)        { w.status = code }
+func (w *bufferedWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsETag(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_value", Help: "A value the test controls"})
+	// The gather duration changes on every scrape, and must not change the
+	// ETag with it.
+	reg.MustRegister(g, metricsGatherDuration)
+	h := newScrapeHandler(reg, false, true)
+	get := func(ifNoneMatch, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Last-Modified") == "" {
+		t.Fatalf("got %d with ETag %q, want 200 with an ETag and Last-Modified", first.Code, etag)
+	}
+	if rec := get(etag, ""); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("unchanged output: got %d with %d bytes, want an empty 304", rec.Code, rec.Body.Len())
+	}
+	if rec := get(etag, "gzip"); rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("gzipped output: got %d with ETag %q, want 200 with an ETag of its own", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	g.Set(1)
+	rec := get(etag, "")
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("changed output: got %d with ETag %q, want 200 with a new ETag", rec.Code, rec.Header().Get("ETag"))
+	}
+}
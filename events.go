@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// newEventsHandler returns the handler for /events, which streams a tick
+// Server-Sent Event every interval, carrying a counter and the time it was
+// sent, until the client disconnects or the server shuts down.
+func newEventsHandler(interval time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			return // without flushing, the client would see nothing until the end
+		}
+		sseConnections.Inc()
+		defer sseConnections.Dec()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for n := 1; ; n++ {
+			select {
+			case t := <-ticker.C:
+				_, err := fmt.Fprintf(w, "id: %d\nevent: tick\ndata: {\"count\":%d,\"time\":%q}\n\n", n, n, t.UTC().Format(time.RFC3339Nano))
+				if err == nil {
+					err = rc.Flush()
+				}
+				if err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			case <-shuttingDown:
+				return
+			}
+		}
+	})
+}
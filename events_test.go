@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEvents(t *testing.T) {
+	ts := httptest.NewServer(newEventsHandler(5 * time.Millisecond))
+	defer ts.Close()
+	before := testutil.ToFloat64(sseConnections)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	var data []string
+	for sc := bufio.NewScanner(resp.Body); len(data) < 2 && sc.Scan(); {
+		if d, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+			data = append(data, d)
+		}
+	}
+	if len(data) != 2 || !strings.HasPrefix(data[0], `{"count":1,`) || !strings.HasPrefix(data[1], `{"count":2,`) {
+		t.Fatalf("got events %q, want counts 1 and 2", data)
+	}
+	if got := testutil.ToFloat64(sseConnections) - before; got != 1 {
+		t.Errorf("sse_connections rose by %v while streaming, want 1", got)
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(sseConnections) != before {
+		if time.Now().After(deadline) {
+			t.Fatal("sse_connections did not drop after the client disconnected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const maxFakeTargets = 1000
+
+var (
+	fakeUpDesc       = prometheus.NewDesc("fake_up", "Whether the fake target is up", []string{"target"}, nil)
+	fakeRequestsDesc = prometheus.NewDesc("fake_requests_total", "Requests served by the fake target", []string{"target"}, nil)
+	fakeCPUDesc      = prometheus.NewDesc("fake_cpu_usage_ratio", "CPU usage of the fake target", []string{"target"}, nil)
+)
+
+// fakeTargets collects the series of n synthetic targets. Each target has its
+// own request rate and CPU usage pattern, derived from its index, so that
+// sum, avg, topk and friends give visibly different answers. The values
+// depend only on the time since start, so repeated scrapes look like a live
+// fleet.
+type fakeTargets struct {
+	n       int
+	elapsed float64
+}
+
+func (f fakeTargets) Describe(ch chan<- *prometheus.Desc) {
+	ch <- fakeUpDesc
+	ch <- fakeRequestsDesc
+	ch <- fakeCPUDesc
+}
+
+func (f fakeTargets) Collect(ch chan<- prometheus.Metric) {
+	for i := range f.n {
+		target := fmt.Sprintf("fake-%d", i)
+		rate := float64(1 + i%10) // requests per second
+		// Every seventh target is down, to have something to alert on.
+		up := 1.0
+		if i%7 == 6 {
+			up = 0
+		}
+		cpu := 0.5 + 0.4*math.Sin(2*math.Pi*f.elapsed/300+float64(i))
+		ch <- prometheus.MustNewConstMetric(fakeUpDesc, prometheus.GaugeValue, up, target)
+		ch <- prometheus.MustNewConstMetric(fakeRequestsDesc, prometheus.CounterValue, math.Floor(rate*f.elapsed), target)
+		ch <- prometheus.MustNewConstMetric(fakeCPUDesc, prometheus.GaugeValue, cpu, target)
+	}
+}
+
+// newFakeTargetsHandler returns the handler for /fake-targets, which serves
+// the metrics of ?targets=N synthetic targets, 3 by default, in any format a
+// scraper negotiates. One scrape config pointed at it yields fleet-like data
+// to practise PromQL aggregations on.
+func newFakeTargetsHandler(start time.Time) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := 3
+		if s := r.URL.Query().Get("targets"); s != "" {
+			var err error
+			if n, err = strconv.Atoi(s); err != nil || n < 0 || n > maxFakeTargets {
+				writeError(w, apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("targets must be an integer between 0 and %d", maxFakeTargets)})
+				return
+			}
+		}
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(fakeTargets{n: n, elapsed: time.Since(start).Seconds()})
+		promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(w, r)
+	})
+}
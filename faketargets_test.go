@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestFakeTargets(t *testing.T) {
+	h := newFakeTargetsHandler(time.Now().Add(-time.Minute))
+	rec := serve(h, http.MethodGet, "/fake-targets?targets=7")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(rec.Body)
+	if err != nil {
+		t.Fatalf("output does not parse: %v", err)
+	}
+	for _, name := range []string{"fake_up", "fake_requests_total", "fake_cpu_usage_ratio"} {
+		mf, ok := families[name]
+		if !ok {
+			t.Errorf("%s is missing", name)
+			continue
+		}
+		if n := len(mf.GetMetric()); n != 7 {
+			t.Errorf("%s has %d series, want one per target", name, n)
+		}
+	}
+	// The seventh target is the one that is down.
+	if up := families["fake_up"].GetMetric()[6]; up.GetGauge().GetValue() != 0 || up.GetLabel()[0].GetValue() != "fake-6" {
+		t.Errorf("got %v, want fake-6 down", up)
+	}
+
+	if rec := serve(h, http.MethodGet, "/fake-targets?targets=1001"); rec.Code != http.StatusBadRequest {
+		t.Errorf("too many targets: got %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// faultInjector adds artificial latency and errors to requests. The settings
+// are atomics so that they can be changed through /admin/fault while requests
+// are being served.
+type faultInjector struct {
+	errorRate atomic.Uint64 // math.Float64bits of a probability in [0, 1]
+	latency   atomic.Int64  // time.Duration added before every request
+}
+
+// faultSettings is the JSON representation of a faultInjector's settings.
+type faultSettings struct {
+	ErrorRate     float64 `json:"error_rate"`
+	LatencyMillis int64   `json:"latency_ms"`
+}
+
+func (f *faultInjector) settings() faultSettings {
+	return faultSettings{
+		ErrorRate:     math.Float64frombits(f.errorRate.Load()),
+		LatencyMillis: time.Duration(f.latency.Load()).Milliseconds(),
+	}
+}
+
+func (f *faultInjector) set(s faultSettings) error {
+	if s.ErrorRate < 0 || s.ErrorRate > 1 {
+		return errors.New("error_rate must be between 0 and 1")
+	}
+	if s.LatencyMillis < 0 {
+		return errors.New("latency_ms must not be negative")
+	}
+	f.errorRate.Store(math.Float64bits(s.ErrorRate))
+	f.latency.Store(int64(time.Duration(s.LatencyMillis) * time.Millisecond))
+	return nil
+}
+
+// wrap delays every request to h by the configured latency, then fails it with
+// a 500 at the configured error rate.
+func (f *faultInjector) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if latency := time.Duration(f.latency.Load()); latency > 0 {
+			if sleepContext(r.Context(), latency) != nil {
+				return
+			}
+		}
+		if rate := math.Float64frombits(f.errorRate.Load()); rate > 0 && rand.Float64() < rate {
+			writeError(w, apiError{Code: http.StatusInternalServerError, Message: "injected fault"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// adminHandler serves /admin/fault: GET returns the current settings and POST
+// replaces them with the JSON settings in the request body.
+func (f *faultInjector) adminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var s faultSettings
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&s); err != nil {
+				writeError(w, apiError{Code: http.StatusBadRequest, Message: "invalid fault settings: " + err.Error()})
+				return
+			}
+			if err := f.set(s); err != nil {
+				writeError(w, apiError{Code: http.StatusBadRequest, Message: err.Error()})
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(f.settings())
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFaultAdmin(t *testing.T) {
+	faults := &faultInjector{}
+	h := faults.wrap(newFoundHandler("hello", "text/plain"))
+	admin := faults.adminHandler()
+	if rec := serve(h, http.MethodGet, "/"); rec.Code != http.StatusOK {
+		t.Fatalf("without faults: got %d, want 200", rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/fault", strings.NewReader(`{"error_rate":1,"latency_ms":50}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /admin/fault: got %d: %s", rec.Code, rec.Body)
+	}
+	start := time.Now()
+	if rec := serve(h, http.MethodGet, "/"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("with an error rate of 1: got %d, want 500", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("with 50ms of latency the request took %s", elapsed)
+	}
+
+	var got faultSettings
+	if err := json.Unmarshal(serve(admin, http.MethodGet, "/admin/fault").Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (faultSettings{ErrorRate: 1, LatencyMillis: 50}); got != want {
+		t.Errorf("GET /admin/fault = %+v, want %+v", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/fault", strings.NewReader(`{"error_rate":2}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /admin/fault with an error rate of 2: got %d, want 400", rec.Code)
+	}
+}
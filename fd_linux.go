@@ -0,0 +1,15 @@
+//go:build linux
+
+package main
+
+import "os"
+
+// countOpenFDs returns the number of file descriptors currently open by this
+// process.
+func countOpenFDs() (int, error) {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
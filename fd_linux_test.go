@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUpdateOpenFDs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	updateOpenFDs(ctx, time.Hour)
+	if n := testutil.ToFloat64(openFDs); n <= 0 {
+		t.Errorf("open_file_descriptors = %v, want a positive number", n)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// countOpenFDs is only implemented on Linux, where /proc/self/fd is available.
+func countOpenFDs() (int, error) {
+	return 0, errors.ErrUnsupported
+}
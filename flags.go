@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// splitList splits a comma-separated flag value, dropping empty elements and
+// surrounding whitespace.
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// durationMap is a repeatable flag of name=duration pairs.
+type durationMap map[string]time.Duration
+
+func (m durationMap) String() string {
+	pairs := make([]string, 0, len(m))
+	for name, d := range m {
+		pairs = append(pairs, name+"="+d.String())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m durationMap) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("%q is not of the form name=duration", s)
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	m[name] = d
+	return nil
+}
+
+// headerFlag is a repeatable flag of Key:Value response headers.
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	var pairs []string
+	for key, values := range h {
+		for _, v := range values {
+			pairs = append(pairs, key+":"+v)
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (h headerFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, ":")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("%q is not of the form Key:Value", s)
+	}
+	http.Header(h).Add(key, strings.TrimSpace(value))
+	return nil
+}
+
+// parseBuckets parses a comma-separated list of histogram bucket upper
+// bounds, which must be strictly increasing.
+func parseBuckets(s string) ([]float64, error) {
+	var buckets []float64
+	for _, e := range splitList(s) {
+		b, err := strconv.ParseFloat(e, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket %q: %w", e, err)
+		}
+		if len(buckets) > 0 && b <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("buckets must be strictly increasing, but %v follows %v", b, buckets[len(buckets)-1])
+		}
+		buckets = append(buckets, b)
+	}
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("at least one bucket is required")
+	}
+	return buckets, nil
+}
+
+// parseStatusCodes parses a comma-separated list of HTTP status codes.
+func parseStatusCodes(s string) ([]int, error) {
+	var codes []int
+	for _, e := range splitList(s) {
+		code, err := strconv.Atoi(e)
+		if err != nil || code < 200 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %q, must be between 200 and 599", e)
+		}
+		codes = append(codes, code)
+	}
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("at least one status code is required")
+	}
+	return codes, nil
+}
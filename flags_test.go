@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDurationMap(t *testing.T) {
+	m := durationMap{}
+	for _, s := range []string{"wait=2s", "hash=500ms"} {
+		if err := m.Set(s); err != nil {
+			t.Fatalf("Set(%q): %v", s, err)
+		}
+	}
+	if m["wait"] != 2*time.Second || m["hash"] != 500*time.Millisecond {
+		t.Errorf("got %v, want wait=2s and hash=500ms", m)
+	}
+	if got, want := m.String(), "hash=500ms,wait=2s"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	for _, s := range []string{"wait", "=2s", "wait=soon"} {
+		if err := m.Set(s); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", s)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// newFlakyHandler returns the handler for /flaky, which answers successive
+// calls with the status codes of sequence in turn, starting over after the
+// last one. Unlike the random errors of -fault-error-rate, the pattern is
+// deterministic, which makes it easy to check that alerts fire, and stop
+// firing, when expected.
+func newFlakyHandler(sequence []int) http.Handler {
+	var calls atomic.Uint64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		code := sequence[(n-1)%uint64(len(sequence))]
+		if code >= 400 {
+			writeError(w, apiError{Code: code, Message: fmt.Sprintf("scheduled failure on call %d", n)})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(struct {
+			Code int    `json:"code"`
+			Call uint64 `json:"call"`
+		}{code, n})
+	})
+}
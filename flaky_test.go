@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFlaky(t *testing.T) {
+	codes, err := parseStatusCodes("200,200,500,503")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newFlakyHandler(codes)
+	want := []int{200, 200, 500, 503, 200, 200, 500, 503, 200}
+	for i, code := range want {
+		if rec := serve(h, http.MethodGet, "/flaky"); rec.Code != code {
+			t.Errorf("call %d: got %d, want %d", i+1, rec.Code, code)
+		}
+	}
+
+	for _, s := range []string{"", "200,abc", "600"} {
+		if _, err := parseStatusCodes(s); err == nil {
+			t.Errorf("parseStatusCodes(%q) succeeded, want an error", s)
+		}
+	}
+}
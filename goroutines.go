@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+const goroutinePeakInterval = time.Second
+
+// trackGoroutinePeak samples runtime.NumGoroutine every interval until ctx is
+// done, keeping the highest count seen in goroutinesPeak. A peak that keeps
+// climbing under steady load points to handlers leaking goroutines.
+func trackGoroutinePeak(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	peak := 0
+	for {
+		if n := runtime.NumGoroutine(); n > peak {
+			peak = n
+			goroutinesPeak.Set(float64(peak))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGoroutinesReturnToBaseline(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/wait/{waitSec}", newWaitHandler(1))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	baseline := runtime.NumGoroutine()
+	go trackGoroutinePeak(ctx, 10*time.Millisecond)
+
+	const clients = 50
+	var wg sync.WaitGroup
+	for range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := ts.Client().Get(ts.URL + "/wait/1"); err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	if peak := testutil.ToFloat64(goroutinesPeak); peak < clients {
+		t.Errorf("goroutines_peak = %v while %d requests were waiting", peak, clients)
+	}
+
+	cancel()
+	ts.Client().CloseIdleConnections()
+	ts.CloseClientConnections()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline+5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines are left after the load, up from %d", runtime.NumGoroutine(), baseline)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
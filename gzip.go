@@ -0,0 +1,130 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// gzipResponses compresses the responses of next at level for clients that
+// accept gzip. Responses that already carry a Content-Encoding, such as
+// /metrics compressing itself, and responses without a body are passed
+// through untouched. Writers are pooled, as each one holds several hundred
+// kilobytes of compression state.
+func gzipResponses(level int, next http.Handler) http.Handler {
+	pool := &sync.Pool{New: func() any {
+		gz, _ := gzip.NewWriterLevel(nil, level) // the level was validated at startup
+		return gz
+	}}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w, pool: pool}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of r allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok && strings.Trim(q, "0.") == "" {
+			continue // q=0 explicitly refuses it
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter holds back the status passed to WriteHeader until the first
+// Write, so that a missing Content-Type can still be sniffed from the
+// uncompressed bytes, and then either compresses the body or passes it
+// through.
+type gzipWriter struct {
+	http.ResponseWriter
+	pool        *sync.Pool
+	gz          *gzip.Writer
+	code        int
+	wroteHeader bool
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+// writeHeader sends the held back status, deciding whether to compress.
+// b is the start of the body, nil if nothing has been written yet.
+func (w *gzipWriter) writeHeader(b []byte) {
+	w.wroteHeader = true
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	h := w.Header()
+	if b != nil && h.Get("Content-Type") == "" {
+		// net/http no longer sniffs once Content-Encoding is set, and
+		// would look at compressed bytes if it did.
+		h.Set("Content-Type", http.DetectContentType(b))
+	}
+	if h.Get("Content-Encoding") == "" && w.code != http.StatusNoContent && w.code != http.StatusNotModified {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.writeHeader(b)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *gzipWriter) Flush() {
+	if !w.wroteHeader {
+		w.writeHeader(nil)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close finishes the compressed stream and returns the writer to the pool.
+// A response without a body is sent uncompressed.
+func (w *gzipWriter) close() {
+	if !w.wroteHeader && w.code != 0 {
+		w.wroteHeader = true
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+	if w.gz == nil {
+		return
+	}
+	w.gz.Close()
+	w.gz.Reset(nil)
+	w.pool.Put(w.gz)
+	w.gz = nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gzipTestBody compresses well, but differently at each level.
+var gzipTestBody = strings.Repeat("Hashing 5 mb, 5 times took 1.234s using 1 workers\n", 200) + fmt.Sprint(make([]int, 500))
+
+// serveGzipped serves a GET of gzipTestBody through h to a client that
+// accepts gzip.
+func serveGzipped(h http.Handler) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGzipLevel(t *testing.T) {
+	for _, level := range []int{gzip.BestSpeed, gzip.DefaultCompression, gzip.BestCompression} {
+		rec := serveGzipped(gzipResponses(level, newFoundHandler(gzipTestBody, "text/plain")))
+		if rec.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("level %d: response is not gzipped", level)
+		}
+		var want bytes.Buffer
+		gz, _ := gzip.NewWriterLevel(&want, level)
+		gz.Write([]byte(gzipTestBody))
+		gz.Close()
+		if !bytes.Equal(rec.Body.Bytes(), want.Bytes()) {
+			t.Errorf("level %d: got %d compressed bytes, want the %d of compressing at that level", level, rec.Body.Len(), want.Len())
+		}
+		r, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := io.ReadAll(r); string(b) != gzipTestBody {
+			t.Errorf("level %d: body does not decompress to the original", level)
+		}
+	}
+}
+
+func BenchmarkGzipLevel(b *testing.B) {
+	for _, level := range []int{gzip.BestSpeed, gzip.DefaultCompression, gzip.BestCompression} {
+		b.Run(fmt.Sprint(level), func(b *testing.B) {
+			h := gzipResponses(level, newFoundHandler(gzipTestBody, "text/plain"))
+			b.ReportAllocs()
+			for range b.N {
+				serveGzipped(h)
+			}
+		})
+	}
+}
+
+func TestGzipSniffsAfterWriteHeader(t *testing.T) {
+	// /wait calls WriteHeader before writing, without a Content-Type.
+	rec := serveGzipped(gzipResponses(gzip.DefaultCompression, newWaitHandler(1)))
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("response is not gzipped")
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain sniffed from the uncompressed body", ct)
+	}
+	r, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != "Waited for 1 seconds." {
+		t.Errorf("body decompresses to %q", b)
+	}
+
+	empty := serveGzipped(gzipResponses(gzip.DefaultCompression, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})))
+	if empty.Code != http.StatusAccepted || empty.Header().Get("Content-Encoding") != "" || empty.Body.Len() != 0 {
+		t.Errorf("a response without a body came back as %d with Content-Encoding %q and %d bytes, want it untouched", empty.Code, empty.Header().Get("Content-Encoding"), empty.Body.Len())
+	}
+}
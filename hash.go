@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// hashConfig configures the handler returned by newHashHandler.
+type hashConfig struct {
+	// defaultMB and defaultIterations apply when the path leaves them out
+	// or they are invalid.
+	defaultMB, defaultIterations int
+	// maxParallel bounds the number of goroutines one request may use.
+	maxParallel int
+	// source returns the reader each hash draws its input from.
+	source func() io.Reader
+	// measureAlloc records the bytes allocated by each request in
+	// hash_alloc_bytes. runtime.ReadMemStats stops the world, so it is opt-in.
+	measureAlloc bool
+	// allowProfile lets requests ask for a CPU profile of their hashing
+	// with ?profile=cpu.
+	allowProfile bool
+}
+
+// hashPatterns are the routes of the hash handler, registered with and
+// without a trailing slash like waitPatterns.
+var hashPatterns = []string{"GET /hash", "GET /hash/{$}", "GET /hash/{mb}", "GET /hash/{mb}/{$}", "GET /hash/{mb}/{iterations}", "GET /hash/{mb}/{iterations}/{$}"}
+
+// newHashHandler returns the handler for /hash/{mb}/{iterations}. The
+// iterations can be spread across up to cfg.maxParallel goroutines with the
+// parallel query parameter, so a single request can load several cores.
+func newHashHandler(cfg hashConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iterationsStr := r.PathValue("iterations")
+		iterations, _ := strconv.Atoi(iterationsStr)
+		if iterations < 1 {
+			iterations = cfg.defaultIterations // errors, no value, and negative values all get the default
+		}
+		mbStr := r.PathValue("mb")
+		mb, _ := strconv.Atoi(mbStr)
+		if mb < 1 {
+			mb = cfg.defaultMB // errors, no value, and negative values all get the default
+		}
+		parallel, _ := strconv.Atoi(r.URL.Query().Get("parallel"))
+		parallel = min(max(parallel, 1), cfg.maxParallel, runtime.GOMAXPROCS(0), iterations)
+
+		var stopProfile func() (string, error)
+		switch profile := r.URL.Query().Get("profile"); {
+		case profile == "":
+		case !cfg.allowProfile:
+			writeError(w, apiError{Code: http.StatusForbidden, Message: "profiling is disabled, start the app with -hash-profile to enable it"})
+			return
+		case profile != "cpu":
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: "profile must be cpu"})
+			return
+		default:
+			var err error
+			stopProfile, err = startCPUProfile()
+			if errors.Is(err, errProfileBusy) {
+				writeError(w, apiError{Code: http.StatusConflict, Message: err.Error()})
+				return
+			} else if err != nil {
+				writeError(w, apiError{Code: http.StatusInternalServerError, Message: "failed to start CPU profile: " + err.Error()})
+				return
+			}
+		}
+
+		fmt.Printf("Hashing %d mb, %d times\n", mb, iterations)
+		var before runtime.MemStats
+		if cfg.measureAlloc {
+			runtime.ReadMemStats(&before)
+		}
+		start := time.Now()
+		digest, busy, phases, err := hashIterations(r.Context(), cfg.source, mb*1024*1024, iterations, parallel)
+		var profilePath string
+		if stopProfile != nil {
+			var perr error
+			if profilePath, perr = stopProfile(); perr != nil {
+				log.Printf("failed to write CPU profile %s: %v", profilePath, perr)
+			}
+		}
+		if err != nil {
+			if profilePath != "" {
+				os.Remove(profilePath)
+			}
+			return // the client went away, nobody is left to answer
+		}
+		elapsed := time.Since(start)
+		if cfg.measureAlloc {
+			// TotalAlloc is process-wide, so concurrent requests inflate
+			// each other's observations.
+			var after runtime.MemStats
+			runtime.ReadMemStats(&after)
+			hashAllocBytes.Observe(float64(after.TotalAlloc - before.TotalAlloc))
+		}
+		if acceptsJSON(r) {
+			b, _ := json.Marshal(hashResult{
+				MB:                mb,
+				Iterations:        iterations,
+				Workers:           parallel,
+				ElapsedSeconds:    elapsed.Seconds(),
+				WorkerTimeSeconds: busy.Seconds(),
+				ReadSeconds:       phases.read.Seconds(),
+				WriteSeconds:      phases.write.Seconds(),
+				SumSeconds:        phases.sum.Seconds(),
+				Hash:              digest,
+				Profile:           profilePath,
+			})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			writeResponse(w, "hash", append(b, '\n'))
+			return
+		}
+		msg := fmt.Sprintf("Hashing %d mb, %d times took %s", mb, iterations, elapsed)
+		if parallel > 1 {
+			msg += fmt.Sprintf(" using %d workers (%s total worker time)", parallel, busy)
+		}
+		msg += fmt.Sprintf(": %s reading random data, %s hashing, %s computing digests", phases.read, phases.write, phases.sum)
+		if profilePath != "" {
+			msg += fmt.Sprintf(", CPU profile written to %s", profilePath)
+		}
+		w.WriteHeader(http.StatusOK)
+		writeResponse(w, "hash", []byte(msg))
+	})
+}
+
+// hashResult is the /hash response for clients that accept JSON.
+type hashResult struct {
+	MB                int     `json:"mb"`
+	Iterations        int     `json:"iterations"`
+	Workers           int     `json:"workers"`
+	ElapsedSeconds    float64 `json:"elapsed_seconds"`
+	WorkerTimeSeconds float64 `json:"worker_time_seconds"`
+	// ReadSeconds, WriteSeconds and SumSeconds break the worker time down
+	// into its phases, see hashPhases.
+	ReadSeconds  float64 `json:"read_seconds"`
+	WriteSeconds float64 `json:"write_seconds"`
+	SumSeconds   float64 `json:"sum_seconds"`
+	// Hash is the digest of the last iteration to complete.
+	Hash string `json:"hash"`
+	// Profile is the path of the CPU profile requested with ?profile=cpu.
+	Profile string `json:"profile,omitempty"`
+}
+
+// hashPhases is the time spent in each phase of hashing: reading the random
+// input, feeding it to the hasher and computing the digest.
+type hashPhases struct {
+	read, write, sum time.Duration
+}
+
+func (p *hashPhases) add(o hashPhases) {
+	p.read += o.read
+	p.write += o.write
+	p.sum += o.sum
+}
+
+// hashIterations hashes bytesToProcess random bytes iterations times, spread
+// as evenly as possible across workers goroutines. It returns the digest of
+// the last iteration to complete, the time the workers spent hashing summed
+// over all of them, and how that time splits into phases.
+func hashIterations(ctx context.Context, source func() io.Reader, bytesToProcess, iterations, workers int) (string, time.Duration, hashPhases, error) {
+	var (
+		busy   atomic.Int64
+		last   atomic.Value
+		mu     sync.Mutex
+		phases hashPhases
+	)
+	// The group's context is cancelled as soon as one worker fails, which
+	// only happens when the request was cancelled, so every worker stops
+	// within a megabyte of hashing instead of finishing its iterations.
+	g, gctx := errgroup.WithContext(ctx)
+	for i := range workers {
+		n := iterations / workers
+		if i < iterations%workers {
+			n++
+		}
+		g.Go(func() error {
+			start := time.Now()
+			defer func() { busy.Add(int64(time.Since(start))) }()
+			for range n {
+				hash, p, err := hashRandomData(gctx, source(), bytesToProcess)
+				mu.Lock()
+				phases.add(p)
+				mu.Unlock()
+				if err != nil {
+					return err
+				}
+				fmt.Println("completed hash with result: " + hash)
+				last.Store(hash)
+			}
+			return nil
+		})
+	}
+	err := g.Wait()
+	digest, _ := last.Load().(string)
+	return digest, time.Duration(busy.Load()), phases, err
+}
+
+// randomSource returns the source of hash input. By default every hash reads
+// from crypto/rand. With deterministic set, every hash instead reads a fresh
+// math/rand stream seeded with seed, so repeated runs do identical work and
+// their timings can be compared. That is meant for benchmarking only; the
+// resulting digests carry no cryptographic meaning.
+func randomSource(deterministic bool, seed int64) func() io.Reader {
+	if !deterministic {
+		return func() io.Reader { return rand.Reader }
+	}
+	return func() io.Reader { return mathrand.New(mathrand.NewSource(seed)) }
+}
+
+func hashRandomData(ctx context.Context, src io.Reader, bytesToProcess int) (string, hashPhases, error) {
+	buffer := make([]byte, 1024) // 1KB buffer
+	hasher := sha256.New()
+
+	var phases hashPhases
+	bytesProcessed := 0
+	h := []byte{}
+	for bytesProcessed < bytesToProcess {
+		if bytesProcessed%(1024*1024) == 0 && ctx.Err() != nil {
+			return "", phases, ctx.Err() // check for cancellation once per mb
+		}
+		t0 := time.Now()
+		io.ReadFull(src, buffer) // Fill buffer with random data
+		t1 := time.Now()
+		hasher.Write(buffer)
+		t2 := time.Now()
+		h = hasher.Sum(nil)
+		t3 := time.Now()
+		phases.read += t1.Sub(t0)
+		phases.write += t2.Sub(t1)
+		phases.sum += t3.Sub(t2)
+		bytesProcessed += len(buffer)
+	}
+
+	return fmt.Sprintf("%x", h), phases, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testHashConfig hashes zeros instead of random data and counts the hashes
+// started in reads.
+func testHashConfig(reads *atomic.Int64) hashConfig {
+	return hashConfig{
+		defaultMB:         1,
+		defaultIterations: 1,
+		maxParallel:       4,
+		source: func() io.Reader {
+			reads.Add(1)
+			return zeroReader{}
+		},
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
+
+// serveHash serves target from the hash handler built from cfg, routed like
+// main routes /hash.
+func serveHash(cfg hashConfig, target string, wantJSON bool) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	h := newHashHandler(cfg)
+	for _, p := range hashPatterns {
+		mux.Handle(p, h)
+	}
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if wantJSON {
+		req.Header.Set("Accept", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHashParallel(t *testing.T) {
+	if runtime.GOMAXPROCS(0) < 2 {
+		t.Skip("needs GOMAXPROCS of at least 2")
+	}
+	var reads atomic.Int64
+	rec := serveHash(testHashConfig(&reads), "/hash/1/5?parallel=2", true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var res hashResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Workers != 2 || res.Iterations != 5 || res.Hash == "" {
+		t.Errorf("got %+v, want 5 iterations on 2 workers and a digest", res)
+	}
+	if n := reads.Load(); n != 5 {
+		t.Errorf("hashed %d times, want 5", n)
+	}
+}
+
+func TestHashDeterministic(t *testing.T) {
+	digest := func(seed int64) string {
+		t.Helper()
+		d, _, err := hashRandomData(context.Background(), randomSource(true, seed)(), 64*1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	if a, b := digest(42), digest(42); a != b {
+		t.Errorf("two runs with seed 42 hashed to %s and %s", a, b)
+	}
+	if a, b := digest(42), digest(43); a == b {
+		t.Errorf("seeds 42 and 43 both hashed to %s", a)
+	}
+}
+
+func TestHashMeasureAlloc(t *testing.T) {
+	var reads atomic.Int64
+	cfg := testHashConfig(&reads)
+	cfg.measureAlloc = true
+	before := histogramOf(t, hashAllocBytes).GetSampleCount()
+	if rec := serveHash(cfg, "/hash/1/1", false); rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	if n := histogramOf(t, hashAllocBytes).GetSampleCount() - before; n != 1 {
+		t.Errorf("hash_alloc_bytes recorded %d observations, want 1", n)
+	}
+}
+
+func TestHashResponseVariants(t *testing.T) {
+	var reads atomic.Int64
+	cfg := testHashConfig(&reads)
+
+	text := serveHash(cfg, "/hash/1/2", false)
+	if text.Code != http.StatusOK || !strings.HasPrefix(text.Body.String(), "Hashing 1 mb, 2 times took ") {
+		t.Errorf("text: got %d %q, want the prose summary", text.Code, text.Body)
+	}
+
+	rec := serveHash(cfg, "/hash/1/2", true)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("JSON: Content-Type = %q, want application/json", ct)
+	}
+	var res hashResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("JSON: body %q: %v", rec.Body, err)
+	}
+	if res.MB != 1 || res.Iterations != 2 || res.ElapsedSeconds <= 0 || len(res.Hash) != 64 {
+		t.Errorf("JSON: got %+v, want 1 mb, 2 iterations, an elapsed time and a SHA-256 digest", res)
+	}
+}
+
+func TestHashProfile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	var reads atomic.Int64
+	cfg := testHashConfig(&reads)
+
+	if rec := serveHash(cfg, "/hash/1/1?profile=cpu", true); rec.Code != http.StatusForbidden {
+		t.Errorf("without -hash-profile: got %d, want 403", rec.Code)
+	}
+
+	cfg.allowProfile = true
+	rec := serveHash(cfg, "/hash/1/1?profile=cpu", true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var res hashResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(res.Profile) != dir {
+		t.Fatalf("profile written to %q, want a file in %s", res.Profile, dir)
+	}
+	if fi, err := os.Stat(res.Profile); err != nil || fi.Size() == 0 {
+		t.Errorf("profile %s is missing or empty: %v", res.Profile, err)
+	}
+
+	profileMu.Lock()
+	rec = serveHash(cfg, "/hash/1/1?profile=cpu", true)
+	profileMu.Unlock()
+	if rec.Code != http.StatusConflict {
+		t.Errorf("while another profile is recorded: got %d, want 409", rec.Code)
+	}
+}
+
+func TestHashPhases(t *testing.T) {
+	start := time.Now()
+	_, phases, err := hashRandomData(context.Background(), randomSource(true, 1)(), 4*1024*1024)
+	total := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if phases.read <= 0 || phases.write <= 0 || phases.sum <= 0 {
+		t.Fatalf("got phases %+v, want time in each of them", phases)
+	}
+	// The phases leave out only the loop bookkeeping between them.
+	if sum := phases.read + phases.write + phases.sum; sum > total || sum < total/2 {
+		t.Errorf("phases sum to %s of the %s total, want most of it", sum, total)
+	}
+}
+
+func TestHashCancelStopsWorkers(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	var reads atomic.Int64
+	cfg := testHashConfig(&reads)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, _, _, err := hashIterations(ctx, cfg.source, 64*1024*1024, 100, 8)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the workers kept hashing after the cancellation")
+	}
+	if n := reads.Load(); n >= 100 {
+		t.Errorf("started %d hashes, want the cancellation to stop the rest of the 100", n)
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines are running, %d before the hash", runtime.NumGoroutine(), baseline)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHashDefaults(t *testing.T) {
+	var reads atomic.Int64
+	cfg := testHashConfig(&reads)
+	cfg.defaultMB, cfg.defaultIterations = 2, 3
+	for _, target := range []string{"/hash", "/hash/", "/hash/abc/0"} {
+		rec := serveHash(cfg, target, true)
+		var res hashResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: got %d %q: %v", target, rec.Code, rec.Body, err)
+		}
+		if res.MB != 2 || res.Iterations != 3 {
+			t.Errorf("%s: hashed %d mb %d times, want the configured 2 mb 3 times", target, res.MB, res.Iterations)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// newHeadersEchoHandler returns the handler for /headers/echo. Every request
+// header named in allowlist is reflected as a response header, prefixed with
+// X-Echo- in place of any leading X-, so X-Forwarded-For comes back as
+// X-Echo-Forwarded-For. This makes proxies' header rewriting visible with
+// nothing more than curl -I.
+func newHeadersEchoHandler(allowlist []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range allowlist {
+			name = http.CanonicalHeaderKey(name)
+			for _, v := range r.Header.Values(name) {
+				w.Header().Add("X-Echo-"+strings.TrimPrefix(name, "X-"), v)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeadersEcho(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/headers/echo", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("X-Secret", "hunter2")
+	rec := httptest.NewRecorder()
+	newHeadersEchoHandler([]string{"x-forwarded-for"}).ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Echo-Forwarded-For"); got != "203.0.113.7" {
+		t.Errorf("X-Echo-Forwarded-For = %q, want the forwarded address", got)
+	}
+	if got := rec.Header().Get("X-Echo-Secret"); got != "" {
+		t.Errorf("X-Secret is not allowlisted but was echoed as %q", got)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type protoKey struct{}
+
+// unmatchedHandler is the handler name of the catch-all route serving paths
+// that no other route matches.
+const unmatchedHandler = "unmatched"
+
+// endpointNames are the handler names of every endpoint main can register,
+// including those that only exist with a flag set, such as static or the
+// -enable-chaos ones. -disable-endpoints and -handler-timeout are checked
+// against this list, so that naming an endpoint that is currently off is not
+// an error.
+var endpointNames = []string{
+	unmatchedHandler, "found", "startupz", "healthz", "readyz", "err", "internal-err",
+	"wait", "hash", "selftest-hash", "payload", "db-query", "redirect", "burn",
+	"fake-targets", "limits", "trace-test", "jitter", "longpoll", "events", "replay",
+	"panic", "dns-lookup", "proxy", "flaky", "deadline", "load", "memory-spike",
+	"headers-echo", "static", "leak-goroutine", "leak-goroutine-stop", "deadlock",
+}
+
+// checkEndpointNames returns an error for the first of names that is not in
+// endpointNames.
+func checkEndpointNames(names []string) error {
+	for _, name := range names {
+		if !slices.Contains(endpointNames, name) {
+			return fmt.Errorf("unknown endpoint %q", name)
+		}
+	}
+	return nil
+}
+
+// unmatchedRoute answers requests for paths that no route serves.
+var unmatchedRoute = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	writeError(w, apiError{Code: http.StatusNotFound, Message: "no route for " + r.URL.Path})
+})
+
+// instrumenter applies the request metrics to every route.
+type instrumenter struct {
+	// sloLatency is the duration above which a request violates the latency
+	// SLO. Zero disables the SLO counters.
+	sloLatency time.Duration
+	// faults injects latency and errors into every instrumented request.
+	faults *faultInjector
+	// timeouts bounds how long the handler with a given name may take.
+	// Handlers not listed get defaultTimeout, except the streaming ones;
+	// zero means no limit.
+	timeouts       map[string]time.Duration
+	defaultTimeout time.Duration
+	// responseSize observes the size of every response. Its buckets are
+	// configured with -response-size-buckets.
+	responseSize *prometheus.HistogramVec
+	// panicDumpDir is where recovered panics get a goroutine dump written.
+	// Empty disables the dumps.
+	panicDumpDir string
+	// disabled lists handlers turned off with -disable-endpoints. Their
+	// routes answer exactly like paths that match no route.
+	disabled map[string]bool
+	// maintenance turns away requests while an operator has the instance
+	// in maintenance mode.
+	maintenance *maintenanceMode
+	// gc samples requests for GC attribution with -per-request-memstats.
+	gc *gcAttribution
+	// slow records the slowest requests for /admin/slow-requests.
+	slow *slowRequestLog
+	// names collects the name of every instrumented handler.
+	names map[string]bool
+}
+
+// newResponseSizeHistogram returns the http_response_size_bytes histogram
+// that instrumenter.responseSize observes into.
+func newResponseSizeHistogram(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_response_size_bytes",
+		Help:    "Size of all HTTP responses",
+		Buckets: buckets,
+	}, []string{"code", "handler", "method"})
+}
+
+// instrument wraps the handler registered as name in the request metrics and
+// middleware, outermost first: the Server-Timing header, the slow request log,
+// the duration and response size histograms, http_size_ratio, the request
+// counter, the SLO counters, the timeout, panic recovery, maintenance mode,
+// GC attribution and fault injection. The counter is labelled with the
+// negotiated protocol version and whether the request matched a route at all.
+// Disabled handlers are replaced by unmatchedRoute.
+func (in instrumenter) instrument(name string, h http.Handler) http.Handler {
+	in.names[name] = true
+	if in.disabled[name] {
+		name, h = unmatchedHandler, unmatchedRoute
+	}
+	counter := httpRequestsTotal.MustCurryWith(prometheus.Labels{
+		"route_matched": strconv.FormatBool(name != unmatchedHandler),
+	})
+	counted := promhttp.InstrumentHandlerCounter(counter, in.slo(name, in.timeout(name, in.recoverPanics(name, in.maintenance.wrap(name, in.gc.wrap(name, in.faults.wrap(h)))))),
+		promhttp.WithLabelFromCtx("proto", func(ctx context.Context) string {
+			proto, _ := ctx.Value(protoKey{}).(string)
+			return proto
+		}),
+	)
+	sized := promhttp.InstrumentHandlerResponseSize(
+		in.responseSize.MustCurryWith(prometheus.Labels{"handler": name}),
+		observeSizeRatio(name, counted),
+	)
+	timed := promhttp.InstrumentHandlerDuration(
+		httpRequestDuration.MustCurryWith(prometheus.Labels{"handler": name}),
+		sized,
+	)
+	logged := in.slow.wrap(name, timed)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &serverTimingWriter{ResponseWriter: w, name: name, start: time.Now()}
+		logged.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), protoKey{}, r.Proto)))
+	})
+}
+
+// observeSizeRatio records how many response bytes h wrote per request byte
+// in http_size_ratio, to show which handlers amplify traffic. The request
+// size is approximated from the request line, headers and body length, so it
+// is never zero even for a bodiless GET.
+func observeSizeRatio(name string, h http.Handler) http.Handler {
+	observer := httpSizeRatio.WithLabelValues(name)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+		observer.Observe(float64(sw.bytes) / float64(approximateRequestSize(r)))
+	})
+}
+
+// approximateRequestSize estimates the size of r on the wire the same way the
+// promhttp request size histogram does.
+func approximateRequestSize(r *http.Request) int {
+	size := len(r.Method) + len(r.URL.String()) + len(r.Proto) + len(r.Host)
+	for name, values := range r.Header {
+		size += len(name)
+		for _, v := range values {
+			size += len(v)
+		}
+	}
+	if r.ContentLength > 0 {
+		size += int(r.ContentLength)
+	}
+	return size
+}
+
+// slo counts every request to h, and separately those slower than
+// in.sloLatency, so the SLO burn rate is a plain ratio of the two counters.
+func (in instrumenter) slo(name string, h http.Handler) http.Handler {
+	if in.sloLatency <= 0 {
+		return h
+	}
+	total := httpRequestsSLOTotal.WithLabelValues(name)
+	violations := httpRequestsSLOViolationsTotal.WithLabelValues(name)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		h.ServeHTTP(w, r)
+		total.Inc()
+		if time.Since(start) > in.sloLatency {
+			violations.Inc()
+		}
+	})
+}
+
+// streamingHandlers hold their response open or stream it as it is produced.
+// The timeout wrapper buffers the whole response, so they are exempt from
+// -request-timeout and only get a timeout set explicitly with -handler-timeout.
+var streamingHandlers = map[string]bool{"events": true, "payload": true, "longpoll": true, "proxy": true}
+
+// timeout answers 504 for requests to the handler registered as name that
+// take longer than its timeout, counting them in http_requests_timed_out_total,
+// and cancels their context so the handler stops working on them. A 504 marks
+// a request that was too slow, whereas the 503 of shedLoad marks one that was
+// turned away because the server was overloaded. Like http.TimeoutHandler,
+// it buffers the response until the handler returns.
+func (in instrumenter) timeout(name string, h http.Handler) http.Handler {
+	d, ok := in.timeouts[name]
+	if !ok && !streamingHandlers[name] {
+		d = in.defaultTimeout
+	}
+	if d <= 0 {
+		return h
+	}
+	timedOut := httpRequestsTimedOutTotal.WithLabelValues(name)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		tw := &timeoutWriter{buf: bufferedWriter{header: http.Header{}, status: http.StatusOK}}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			h.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			maps.Copy(w.Header(), tw.buf.header)
+			w.WriteHeader(tw.buf.status)
+			w.Write(tw.buf.body.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			tw.timedOut = true
+			if r.Context().Err() != nil {
+				return // the client went away, nobody is left to answer
+			}
+			timedOut.Inc()
+			writeError(w, apiError{Code: http.StatusGatewayTimeout, Message: fmt.Sprintf("handler %s timed out after %s", name, d)})
+		}
+	})
+}
+
+// timeoutWriter buffers the response of a handler run by timeout, and
+// discards whatever the handler writes once it has timed out.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	buf      bufferedWriter
+	timedOut bool
+	wrote    bool
+}
+
+func (w *timeoutWriter) Header() http.Header { return w.buf.header }
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.wrote {
+		return
+	}
+	w.wrote = true
+	w.buf.WriteHeader(code)
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.wrote = true
+	return w.buf.Write(b)
+}
+
+// serverTimingWriter reports the time spent in the handler named name to the
+// client in a Server-Timing header, so browser devtools and clients can see
+// the server side of a slow request. Headers cannot change once the body has
+// started, so the duration covers the time up to the first byte written.
+type serverTimingWriter struct {
+	http.ResponseWriter
+	name        string
+	start       time.Time
+	wroteHeader bool
+}
+
+func (w *serverTimingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		dur := float64(time.Since(w.start).Microseconds()) / 1000
+		w.Header().Set("Server-Timing", fmt.Sprintf("handler;desc=%q;dur=%.1f", w.name, dur))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *serverTimingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *serverTimingWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *serverTimingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
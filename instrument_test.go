@@ -0,0 +1,268 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestInstrumenter returns an instrumenter with every optional wrapper
+// turned off, as main sets it up without flags.
+func newTestInstrumenter() instrumenter {
+	return instrumenter{
+		faults:       &faultInjector{},
+		responseSize: newResponseSizeHistogram(prometheus.ExponentialBuckets(100, 10, 8)),
+		names:        map[string]bool{},
+	}
+}
+
+// BenchmarkInstrumentation serves GET / from the same handler bare and
+// wrapped by instrument. The difference between the two is the overhead of
+// the instrumentation.
+func BenchmarkInstrumentation(b *testing.B) {
+	inst := newTestInstrumenter()
+	found := newFoundHandler("Hello from example application.", "text/plain")
+	for _, bc := range []struct {
+		name string
+		h    http.Handler
+	}{
+		{"bare", found},
+		{"instrumented", inst.instrument("found", found)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			b.ReportAllocs()
+			for range b.N {
+				bc.h.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
+
+func TestInstrumentProto(t *testing.T) {
+	inst := newTestInstrumenter()
+	h := inst.instrument("found", newFoundHandler("hello", "text/plain"))
+	plain := httptest.NewServer(h)
+	defer plain.Close()
+	h2 := httptest.NewUnstartedServer(h)
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+
+	for proto, ts := range map[string]*httptest.Server{"HTTP/1.1": plain, "HTTP/2.0": h2} {
+		counter := httpRequestsTotal.WithLabelValues("200", "get", proto, "true")
+		before := testutil.ToFloat64(counter)
+		resp, err := ts.Client().Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.Proto != proto {
+			t.Fatalf("got a %s response, want %s", resp.Proto, proto)
+		}
+		if got := testutil.ToFloat64(counter) - before; got != 1 {
+			t.Errorf("http_requests_total{proto=%q} increased by %v, want 1", proto, got)
+		}
+	}
+}
+
+func TestSLOViolations(t *testing.T) {
+	inst := newTestInstrumenter()
+	inst.sloLatency = 500 * time.Millisecond
+	mux := http.NewServeMux()
+	mux.Handle("/wait/{waitSec}", inst.instrument("wait", newWaitHandler(1)))
+	mux.Handle("/{$}", inst.instrument("found", newFoundHandler("hello", "text/plain")))
+
+	for _, tc := range []struct {
+		target, handler string
+		violations      float64
+	}{
+		{"/wait/1", "wait", 1},
+		{"/", "found", 0},
+	} {
+		total, violations := httpRequestsSLOTotal.WithLabelValues(tc.handler), httpRequestsSLOViolationsTotal.WithLabelValues(tc.handler)
+		totalBefore, violationsBefore := testutil.ToFloat64(total), testutil.ToFloat64(violations)
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if got := testutil.ToFloat64(total) - totalBefore; got != 1 {
+			t.Errorf("%s: http_requests_slo_total increased by %v, want 1", tc.target, got)
+		}
+		if got := testutil.ToFloat64(violations) - violationsBefore; got != tc.violations {
+			t.Errorf("%s: http_requests_slo_violations_total increased by %v, want %v", tc.target, got, tc.violations)
+		}
+	}
+}
+
+func TestServerTiming(t *testing.T) {
+	inst := newTestInstrumenter()
+	rec := serve(inst.instrument("found", newFoundHandler("hello", "text/plain")), http.MethodGet, "/")
+	timing := rec.Header().Get("Server-Timing")
+	_, dur, ok := strings.Cut(timing, ";dur=")
+	if !strings.HasPrefix(timing, `handler;desc="found"`) || !ok {
+		t.Fatalf("Server-Timing = %q, want the handler name and a duration", timing)
+	}
+	if ms, err := strconv.ParseFloat(dur, 64); err != nil || ms < 0 {
+		t.Errorf("Server-Timing duration %q is not a non-negative number", dur)
+	}
+}
+
+// slowHandler answers 200 after d, or returns early once the request is
+// cancelled.
+func slowHandler(d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(d):
+			w.Write([]byte("done"))
+		case <-r.Context().Done():
+		}
+	})
+}
+
+func TestHandlerTimeouts(t *testing.T) {
+	inst := newTestInstrumenter()
+	inst.defaultTimeout = 20 * time.Millisecond
+	inst.timeouts = map[string]time.Duration{"wait": 10 * time.Millisecond, "hash": time.Second}
+
+	for _, tc := range []struct {
+		name string
+		code int
+	}{
+		{"wait", http.StatusGatewayTimeout},  // its own timeout is shorter than the handler
+		{"hash", http.StatusOK},              // its own timeout is longer than the default
+		{"found", http.StatusGatewayTimeout}, // falls back to -request-timeout
+		{"events", http.StatusOK},            // streaming handlers are exempt from the default
+		{"proxy", http.StatusOK},             // streams the upstream body as it arrives
+	} {
+		timedOut := httpRequestsTimedOutTotal.WithLabelValues(tc.name)
+		before := testutil.ToFloat64(timedOut)
+		rec := serve(inst.timeout(tc.name, slowHandler(50*time.Millisecond)), http.MethodGet, "/")
+		if rec.Code != tc.code {
+			t.Errorf("%s: got %d, want %d", tc.name, rec.Code, tc.code)
+		}
+		want := 0.0
+		if tc.code == http.StatusGatewayTimeout {
+			want = 1
+		}
+		if got := testutil.ToFloat64(timedOut) - before; got != want {
+			t.Errorf("%s: http_requests_timed_out_total increased by %v, want %v", tc.name, got, want)
+		}
+	}
+}
+
+func TestResponseSizeBuckets(t *testing.T) {
+	buckets, err := parseBuckets("10, 1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst := newTestInstrumenter()
+	inst.responseSize = newResponseSizeHistogram(buckets)
+	serve(inst.instrument("found", newFoundHandler(strings.Repeat("x", 500), "text/plain")), http.MethodGet, "/")
+
+	h := histogramOf(t, inst.responseSize.WithLabelValues("200", "found", "get"))
+	var bounds []float64
+	var counts []uint64
+	for _, b := range h.GetBucket() {
+		bounds = append(bounds, b.GetUpperBound())
+		counts = append(counts, b.GetCumulativeCount())
+	}
+	if len(bounds) != 2 || bounds[0] != 10 || bounds[1] != 1000 {
+		t.Fatalf("got buckets %v, want the configured 10 and 1000", bounds)
+	}
+	if counts[0] != 0 || counts[1] != 1 {
+		t.Errorf("a 500 byte response gave cumulative counts %v, want [0 1]", counts)
+	}
+
+	for _, s := range []string{"1000,10", "10,10", "", "ten"} {
+		if _, err := parseBuckets(s); err == nil {
+			t.Errorf("parseBuckets(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestDisabledEndpoints(t *testing.T) {
+	inst := newTestInstrumenter()
+	inst.disabled = map[string]bool{"panic": true}
+	mux := newRouter()
+	mux.Handle("/panic", inst.instrument("panic", newPanicHandler()))
+	mux.Handle("/{$}", inst.instrument("found", newFoundHandler("hello", "text/plain")))
+	mux.Handle("/", inst.instrument(unmatchedHandler, unmatchedRoute))
+
+	if rec := serve(mux, http.MethodGet, "/panic"); rec.Code != http.StatusNotFound {
+		t.Errorf("disabled /panic: got %d, want 404", rec.Code)
+	}
+	if rec := serve(mux, http.MethodGet, "/"); rec.Code != http.StatusOK {
+		t.Errorf("/: got %d, want 200", rec.Code)
+	}
+	// Disabled handlers still count as known to -disable-endpoints.
+	if !inst.names["panic"] {
+		t.Error("the disabled panic handler is not in the known names")
+	}
+}
+
+func TestTimeoutVersusShed(t *testing.T) {
+	inst := newTestInstrumenter()
+	inst.timeouts = map[string]time.Duration{"wait": 20 * time.Millisecond}
+	mux := http.NewServeMux()
+	mux.Handle("/wait/{waitSec}", inst.instrument("wait", shedLoad("wait", 2, newWaitHandler(1))))
+
+	timedOut, shed := httpRequestsTimedOutTotal.WithLabelValues("wait"), httpRequestsShedTotal.WithLabelValues("wait")
+	for _, tc := range []struct {
+		name              string
+		inFlight          int64
+		code              int
+		timedOut, wasShed float64
+	}{
+		{"too slow", 0, http.StatusGatewayTimeout, 1, 0},
+		{"overloaded", 3, http.StatusServiceUnavailable, 0, 1},
+	} {
+		inFlight.Store(tc.inFlight)
+		timedOutBefore, shedBefore := testutil.ToFloat64(timedOut), testutil.ToFloat64(shed)
+		rec := serve(mux, http.MethodGet, "/wait/1")
+		inFlight.Store(0)
+		if rec.Code != tc.code {
+			t.Errorf("%s: got %d, want %d", tc.name, rec.Code, tc.code)
+		}
+		if got := testutil.ToFloat64(timedOut) - timedOutBefore; got != tc.timedOut {
+			t.Errorf("%s: http_requests_timed_out_total increased by %v, want %v", tc.name, got, tc.timedOut)
+		}
+		if got := testutil.ToFloat64(shed) - shedBefore; got != tc.wasShed {
+			t.Errorf("%s: http_requests_shed_total increased by %v, want %v", tc.name, got, tc.wasShed)
+		}
+	}
+}
+
+func TestSizeRatio(t *testing.T) {
+	h := observeSizeRatio("ratio", newFoundHandler(strings.Repeat("x", 1000), "text/plain"))
+	before := histogramOf(t, httpSizeRatio.WithLabelValues("ratio"))
+	// GET, /payload/1000, HTTP/1.1 and example.com make a 35 byte request.
+	req := httptest.NewRequest(http.MethodGet, "/payload/1000", nil)
+	if n := approximateRequestSize(req); n != 35 {
+		t.Fatalf("approximated the request as %d bytes, want 35", n)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	after := histogramOf(t, httpSizeRatio.WithLabelValues("ratio"))
+	if n := after.GetSampleCount() - before.GetSampleCount(); n != 1 {
+		t.Fatalf("http_size_ratio observed %d requests, want 1", n)
+	}
+	// The sum accumulates over runs, so the delta is only close to exact.
+	if ratio := after.GetSampleSum() - before.GetSampleSum(); math.Abs(ratio-1000.0/35) > 1e-9 {
+		t.Errorf("observed a ratio of %v, want 1000/35", ratio)
+	}
+}
+
+func TestCheckEndpointNames(t *testing.T) {
+	// static and deadlock are only registered with -static-dir and
+	// -enable-chaos, but can be named whatever the flags.
+	if err := checkEndpointNames([]string{"hash", "static", "deadlock", unmatchedHandler}); err != nil {
+		t.Errorf("valid names: %v", err)
+	}
+	if err := checkEndpointNames([]string{"hash", "nope"}); err == nil || !strings.Contains(err.Error(), `"nope"`) {
+		t.Errorf("got %v, want an error naming nope", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	jitterInterval = 100 * time.Millisecond
+	// jitterWindow is how many recent samples /jitter summarises, a minute's
+	// worth at jitterInterval.
+	jitterWindow = 600
+)
+
+// jitterMonitor measures how late the runtime wakes a sleeping goroutine. On
+// an idle machine the delay stays well below a millisecond; CPU throttling or
+// noisy neighbours push it up, and with it the latency of every endpoint.
+type jitterMonitor struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+// run sleeps for jitterInterval at a time until ctx is done, recording how
+// much longer than that each sleep took.
+func (j *jitterMonitor) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		start := time.Now()
+		time.Sleep(jitterInterval)
+		late := max(time.Since(start)-jitterInterval, 0)
+		schedulerJitter.Observe(late.Seconds())
+		j.record(late)
+	}
+}
+
+func (j *jitterMonitor) record(d time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.samples) < jitterWindow {
+		j.samples = append(j.samples, d)
+		return
+	}
+	j.samples[j.next] = d
+	j.next = (j.next + 1) % jitterWindow
+}
+
+// jitterStats is the JSON body returned by /jitter.
+type jitterStats struct {
+	Samples     int     `json:"samples"`
+	MeanSeconds float64 `json:"mean_seconds"`
+	P50Seconds  float64 `json:"p50_seconds"`
+	P99Seconds  float64 `json:"p99_seconds"`
+	MaxSeconds  float64 `json:"max_seconds"`
+}
+
+func (j *jitterMonitor) stats() jitterStats {
+	j.mu.Lock()
+	samples := slices.Clone(j.samples)
+	j.mu.Unlock()
+	if len(samples) == 0 {
+		return jitterStats{}
+	}
+	slices.Sort(samples)
+	var sum time.Duration
+	for _, d := range samples {
+		sum += d
+	}
+	quantile := func(q float64) float64 {
+		return samples[int(q*float64(len(samples)-1))].Seconds()
+	}
+	return jitterStats{
+		Samples:     len(samples),
+		MeanSeconds: (sum / time.Duration(len(samples))).Seconds(),
+		P50Seconds:  quantile(0.5),
+		P99Seconds:  quantile(0.99),
+		MaxSeconds:  samples[len(samples)-1].Seconds(),
+	}
+}
+
+// handler serves /jitter: statistics over the most recent samples.
+func (j *jitterMonitor) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(j.stats())
+	})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestJitterMonitor(t *testing.T) {
+	var j jitterMonitor
+	before := histogramOf(t, schedulerJitter).GetSampleCount()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*jitterInterval+jitterInterval/2)
+	defer cancel()
+	j.run(ctx)
+
+	observed := histogramOf(t, schedulerJitter).GetSampleCount() - before
+	if observed < 3 {
+		t.Errorf("scheduler_jitter_seconds observed %d samples over 3.5 intervals, want at least 3", observed)
+	}
+	var stats jitterStats
+	if err := json.Unmarshal(serve(j.handler(), http.MethodGet, "/jitter").Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if uint64(stats.Samples) != observed {
+		t.Errorf("/jitter summarises %d samples, want the %d observed", stats.Samples, observed)
+	}
+	if stats.MaxSeconds < stats.P50Seconds || stats.MaxSeconds > time.Second.Seconds() {
+		t.Errorf("got %+v, want plausible statistics", stats)
+	}
+}
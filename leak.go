@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// goroutineLeak deliberately leaks goroutines for /leak-goroutine, so that
+// leak detection on go_goroutines can be practised. Every goroutine blocks on
+// the current release channel until /leak-goroutine/stop closes it.
+type goroutineLeak struct {
+	mu      sync.Mutex
+	release chan struct{}
+	leaked  int
+}
+
+func newGoroutineLeak() *goroutineLeak {
+	return &goroutineLeak{release: make(chan struct{})}
+}
+
+// leakHandler serves /leak-goroutine, which leaks one more goroutine.
+func (l *goroutineLeak) leakHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		release := l.release
+		l.leaked++
+		leaked := l.leaked
+		l.mu.Unlock()
+		go func() { <-release }()
+		leakedGoroutinesTotal.Inc()
+		l.writeLeaked(w, leaked)
+	})
+}
+
+// stopHandler serves /leak-goroutine/stop, which releases every goroutine
+// leaked so far.
+func (l *goroutineLeak) stopHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		close(l.release)
+		l.release = make(chan struct{})
+		l.leaked = 0
+		l.mu.Unlock()
+		l.writeLeaked(w, 0)
+	})
+}
+
+func (l *goroutineLeak) writeLeaked(w http.ResponseWriter, leaked int) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Leaked int `json:"leaked"`
+	}{leaked})
+}
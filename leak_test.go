@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGoroutineLeak(t *testing.T) {
+	l := newGoroutineLeak()
+	baseline := testutil.ToFloat64(goGoroutines)
+	leaked := testutil.ToFloat64(leakedGoroutinesTotal)
+
+	const leaks = 20
+	for range leaks {
+		serve(l.leakHandler(), http.MethodGet, "/leak-goroutine")
+	}
+	if got := testutil.ToFloat64(goGoroutines) - baseline; got < leaks {
+		t.Errorf("go_goroutines rose by %v after %d leaks", got, leaks)
+	}
+	if got := testutil.ToFloat64(leakedGoroutinesTotal) - leaked; got != leaks {
+		t.Errorf("leaked_goroutines_total increased by %v, want %d", got, leaks)
+	}
+
+	serve(l.stopHandler(), http.MethodGet, "/leak-goroutine/stop")
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(goGoroutines) >= baseline+leaks {
+		if time.Now().After(deadline) {
+			t.Fatalf("go_goroutines is still %v after stopping, up from %v", testutil.ToFloat64(goGoroutines), baseline)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
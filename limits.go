@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime"
+)
+
+// resourceLimits is the JSON body returned by /limits. Limits that are null
+// are unlimited, or not set by any cgroup.
+type resourceLimits struct {
+	OpenFiles    rlimit `json:"open_files"`
+	AddressSpace rlimit `json:"address_space_bytes"`
+	Data         rlimit `json:"data_bytes"`
+	// CgroupVersion is 1 or 2, or 0 if no cgroup limits could be read.
+	CgroupVersion     int      `json:"cgroup_version"`
+	CgroupMemoryBytes *uint64  `json:"cgroup_memory_limit_bytes"`
+	CgroupCPUCores    *float64 `json:"cgroup_cpu_limit_cores"`
+	NumCPU            int      `json:"num_cpu"`
+	GOMAXPROCS        int      `json:"gomaxprocs"`
+}
+
+// rlimit is a soft and hard resource limit of the process.
+type rlimit struct {
+	Soft *uint64 `json:"soft"`
+	Hard *uint64 `json:"hard"`
+}
+
+// newLimitsHandler returns the handler for /limits, which reports the
+// process's resource limits and its cgroup's CPU and memory limits, to help
+// explain why expensive endpoints behave differently across environments.
+// It answers 501 outside Linux.
+func newLimitsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits, err := readResourceLimits()
+		if errors.Is(err, errors.ErrUnsupported) {
+			writeError(w, apiError{Code: http.StatusNotImplemented, Message: "resource limits can only be read on Linux"})
+			return
+		} else if err != nil {
+			writeError(w, apiError{Code: http.StatusInternalServerError, Message: "failed to read resource limits: " + err.Error()})
+			return
+		}
+		limits.NumCPU = runtime.NumCPU()
+		limits.GOMAXPROCS = runtime.GOMAXPROCS(0)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(limits)
+	})
+}
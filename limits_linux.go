@@ -0,0 +1,125 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// cgroupUnlimited is the smallest cgroup v1 limit treated as unlimited. v1
+// reports no limit as a page-aligned value close to the maximum int64.
+const cgroupUnlimited = 1 << 62
+
+// readResourceLimits reads the process's rlimits and, if the process runs in
+// a cgroup of either version, the cgroup's limits.
+func readResourceLimits() (resourceLimits, error) {
+	var limits resourceLimits
+	for _, l := range []struct {
+		resource int
+		dst      *rlimit
+	}{
+		{syscall.RLIMIT_NOFILE, &limits.OpenFiles},
+		{syscall.RLIMIT_AS, &limits.AddressSpace},
+		{syscall.RLIMIT_DATA, &limits.Data},
+	} {
+		var rl syscall.Rlimit
+		if err := syscall.Getrlimit(l.resource, &rl); err != nil {
+			return limits, err
+		}
+		*l.dst = rlimit{Soft: finiteRlimit(rl.Cur), Hard: finiteRlimit(rl.Max)}
+	}
+	readCgroupLimits(&limits)
+	return limits, nil
+}
+
+func finiteRlimit(v uint64) *uint64 {
+	if v == unix.RLIM_INFINITY {
+		return nil
+	}
+	return &v
+}
+
+// readCgroupLimits fills in the cgroup limits of the process, preferring
+// cgroup v2. Unreadable files are skipped, so a process outside any cgroup
+// is simply reported as unlimited.
+func readCgroupLimits(limits *resourceLimits) {
+	paths := cgroupPaths()
+	if dir, ok := cgroupDir("/sys/fs/cgroup", paths[""], "memory.max"); ok {
+		limits.CgroupVersion = 2
+		if v, err := strconv.ParseUint(readTrimmed(filepath.Join(dir, "memory.max")), 10, 64); err == nil {
+			limits.CgroupMemoryBytes = &v
+		}
+		// cpu.max holds "$QUOTA $PERIOD", with a quota of "max" for none.
+		if quota, period, ok := strings.Cut(readTrimmed(filepath.Join(dir, "cpu.max")), " "); ok {
+			limits.CgroupCPUCores = cpuCores(quota, period)
+		}
+		return
+	}
+	if dir, ok := cgroupDir("/sys/fs/cgroup/memory", paths["memory"], "memory.limit_in_bytes"); ok {
+		limits.CgroupVersion = 1
+		if v, err := strconv.ParseUint(readTrimmed(filepath.Join(dir, "memory.limit_in_bytes")), 10, 64); err == nil && v < cgroupUnlimited {
+			limits.CgroupMemoryBytes = &v
+		}
+	}
+	if dir, ok := cgroupDir("/sys/fs/cgroup/cpu", paths["cpu"], "cpu.cfs_quota_us"); ok {
+		limits.CgroupVersion = 1
+		limits.CgroupCPUCores = cpuCores(readTrimmed(filepath.Join(dir, "cpu.cfs_quota_us")), readTrimmed(filepath.Join(dir, "cpu.cfs_period_us")))
+	}
+}
+
+// cgroupPaths maps each cgroup v1 controller of the process to its cgroup
+// path, and "" to its cgroup v2 path, as listed in /proc/self/cgroup.
+func cgroupPaths() map[string]string {
+	paths := map[string]string{}
+	for _, line := range strings.Split(readTrimmed("/proc/self/cgroup"), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+	return paths
+}
+
+// cgroupDir returns the directory below root holding file for the cgroup at
+// path. Inside a container the cgroup is usually mounted as root itself, so
+// that is tried as well.
+func cgroupDir(root, path, file string) (string, bool) {
+	for _, dir := range []string{filepath.Join(root, path), root} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// cpuCores converts a CFS quota and period, both in microseconds, into a
+// number of cores. It returns nil if there is no quota.
+func cpuCores(quota, period string) *float64 {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return nil // "max" in v2, -1 in v1
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return nil
+	}
+	cores := q / p
+	return &cores
+}
+
+func readTrimmed(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
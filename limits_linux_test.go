@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	rec := serve(newLimitsHandler(), http.MethodGet, "/limits")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var limits resourceLimits
+	if err := json.Unmarshal(rec.Body.Bytes(), &limits); err != nil {
+		t.Fatal(err)
+	}
+	if soft := limits.OpenFiles.Soft; soft == nil || *soft == 0 {
+		t.Errorf("open_files.soft = %v, want a positive number", soft)
+	}
+	if limits.NumCPU <= 0 || limits.GOMAXPROCS <= 0 {
+		t.Errorf("got num_cpu %d and gomaxprocs %d, want both positive", limits.NumCPU, limits.GOMAXPROCS)
+	}
+}
+
+func TestCPUCores(t *testing.T) {
+	if c := cpuCores("150000", "100000"); c == nil || *c != 1.5 {
+		t.Errorf("a 150ms quota per 100ms period gave %v cores, want 1.5", c)
+	}
+	for _, quota := range []string{"max", "-1"} {
+		if c := cpuCores(quota, "100000"); c != nil {
+			t.Errorf("quota %q gave %v cores, want no limit", quota, *c)
+		}
+	}
+}
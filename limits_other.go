@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// readResourceLimits is only implemented on Linux.
+func readResourceLimits() (resourceLimits, error) {
+	return resourceLimits{}, errors.ErrUnsupported
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// loadLimits bounds what a single /load request may ask for.
+type loadLimits struct {
+	maxCPU   time.Duration
+	maxMemMB int
+	maxSleep time.Duration
+}
+
+// loadSummary is the JSON body returned by /load.
+type loadSummary struct {
+	CPUMillis      int     `json:"cpu_ms"`
+	MemMB          int     `json:"mem_mb"`
+	SleepMillis    int     `json:"sleep_ms"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// newLoadHandler returns the handler for /load, which shapes a load profile in
+// a single request: it allocates mem_mb megabytes, keeps them alive while it
+// burns cpu_ms of CPU time and then sleeps for sleep_ms. Parameters that are
+// left out are skipped. Every step stops early when the client goes away.
+func newLoadHandler(limits loadLimits) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cpuMs, err := loadParam(r, "cpu_ms", int(limits.maxCPU.Milliseconds()))
+		if err != nil {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
+		memMB, err := loadParam(r, "mem_mb", limits.maxMemMB)
+		if err != nil {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
+		sleepMs, err := loadParam(r, "sleep_ms", int(limits.maxSleep.Milliseconds()))
+		if err != nil {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
+
+		ctx := r.Context()
+		start := time.Now()
+		mem := allocate(memMB)
+		if burnCPU(ctx, time.Duration(cpuMs)*time.Millisecond) != nil {
+			return
+		}
+		if sleepContext(ctx, time.Duration(sleepMs)*time.Millisecond) != nil {
+			return
+		}
+		runtime.KeepAlive(mem)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(loadSummary{
+			CPUMillis:      cpuMs,
+			MemMB:          memMB,
+			SleepMillis:    sleepMs,
+			ElapsedSeconds: time.Since(start).Seconds(),
+		})
+	})
+}
+
+// loadParam parses the non-negative integer query parameter name, which
+// defaults to 0 and may not exceed limit.
+func loadParam(r *http.Request, name string, limit int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	if v > limit {
+		return 0, fmt.Errorf("%s must not exceed %d", name, limit)
+	}
+	return v, nil
+}
+
+// allocate returns mb megabytes of memory, touching every page so that it is
+// actually resident rather than just reserved.
+func allocate(mb int) []byte {
+	b := make([]byte, mb*1024*1024)
+	for i := 0; i < len(b); i += 4096 {
+		b[i] = 1
+	}
+	return b
+}
+
+// burnCPU keeps one core busy for d, or until ctx is done.
+func burnCPU(ctx context.Context, d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for i := 0; time.Now().Before(deadline); i++ {
+		if i%1024 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// sleepContext sleeps for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	h := newLoadHandler(loadLimits{maxCPU: time.Second, maxMemMB: 16, maxSleep: time.Second})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/load?cpu_ms=50&mem_mb=8&sleep_ms=50", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var summary loadSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.CPUMillis != 50 || summary.MemMB != 8 || summary.SleepMillis != 50 {
+		t.Errorf("got %+v, want the requested cpu_ms, mem_mb and sleep_ms", summary)
+	}
+	if summary.ElapsedSeconds < 0.1 {
+		t.Errorf("took %vs, want at least the 100ms of CPU and sleep", summary.ElapsedSeconds)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/load?mem_mb=17", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("mem_mb above the limit: got %d, want 400", rec.Code)
+	}
+}
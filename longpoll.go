@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// broadcast wakes every /longpoll waiter at once. Each notification closes
+// the current round's channel, which all waiters of that round select on, and
+// starts a new round.
+type broadcast struct {
+	mu    sync.Mutex
+	round *broadcastRound
+}
+
+type broadcastRound struct {
+	done    chan struct{}
+	payload []byte
+}
+
+func newBroadcast() *broadcast {
+	return &broadcast{round: &broadcastRound{done: make(chan struct{})}}
+}
+
+// current returns the round that the next notify will complete.
+func (b *broadcast) current() *broadcastRound {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.round
+}
+
+// notify completes the current round with payload.
+func (b *broadcast) notify(payload []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.round.payload = payload
+	close(b.round.done)
+	b.round = &broadcastRound{done: make(chan struct{})}
+}
+
+// longPollHandler returns the handler for /longpoll, which holds the request
+// until POST /admin/notify is called and then answers with the notified
+// payload. After timeout it gives up and answers 204.
+func (b *broadcast) longPollHandler(timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		round := b.current()
+		longPollWaiters.Inc()
+		defer longPollWaiters.Dec()
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-round.done:
+		case <-timer.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		case <-shuttingDown:
+			writeError(w, apiError{Code: http.StatusServiceUnavailable, Message: "server is shutting down"})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		writeResponse(w, "longpoll", round.payload)
+	})
+}
+
+// notifyHandler serves POST /admin/notify, which releases every waiting
+// /longpoll request with the request body as their response.
+func (b *broadcast) notifyHandler(maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+		if err != nil {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: "failed to read payload: " + err.Error()})
+			return
+		}
+		b.notify(payload)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLongPoll(t *testing.T) {
+	b := newBroadcast()
+	poll := b.longPollHandler(time.Minute)
+	before := testutil.ToFloat64(longPollWaiters)
+
+	const waiters = 2
+	results := make(chan *httptest.ResponseRecorder, waiters)
+	for range waiters {
+		go func() { results <- serve(poll, http.MethodGet, "/longpoll") }()
+	}
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(longPollWaiters)-before != waiters {
+		if time.Now().After(deadline) {
+			t.Fatalf("long_poll_waiters did not reach %d", waiters)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	b.notifyHandler(1024).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/notify", strings.NewReader("wake up")))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("notify: got %d: %s", rec.Code, rec.Body)
+	}
+	for range waiters {
+		select {
+		case rec := <-results:
+			if rec.Code != http.StatusOK || rec.Body.String() != "wake up" {
+				t.Errorf("waiter got %d %q, want the notified payload", rec.Code, rec.Body)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("a waiter was not released by the notification")
+		}
+	}
+	if got := testutil.ToFloat64(longPollWaiters) - before; got != 0 {
+		t.Errorf("long_poll_waiters is %v above where it started", got)
+	}
+
+	if rec := serve(b.longPollHandler(10*time.Millisecond), http.MethodGet, "/longpoll"); rec.Code != http.StatusNoContent {
+		t.Errorf("without a notification: got %d, want 204", rec.Code)
+	}
+}
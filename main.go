@@ -1,18 +1,34 @@
 package main
 
 import (
-	"crypto/rand"
-	"crypto/sha256"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"maps"
+	"mime"
+	"net"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/quic-go/quic-go/http3"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 )
@@ -27,35 +43,540 @@ var (
 		},
 	})
 
+	// goInfo mirrors the go_info metric of collectors.NewGoCollector, which is
+	// not registered with this app's registry. Do not register both.
+	goInfo = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "go_info",
+		Help: "Information about the Go environment.",
+		ConstLabels: map[string]string{
+			"version": runtime.Version(),
+		},
+	})
+
+	// goGoroutines mirrors go_goroutines of collectors.NewGoCollector, for the
+	// same reason as goInfo.
+	goGoroutines = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "go_goroutines",
+		Help: "Number of goroutines that currently exist.",
+	}, func() float64 { return float64(runtime.NumGoroutine()) })
+
 	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "http_requests_total",
 		Help: "Count of all HTTP requests",
-	}, []string{"code", "method"})
+	}, []string{"code", "method", "proto", "route_matched"})
 
 	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name: "http_request_duration_seconds",
 		Help: "Duration of all HTTP requests",
 	}, []string{"code", "handler", "method"})
+
+	openFDs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "open_file_descriptors",
+		Help: "Number of file descriptors currently open by this process",
+	})
+
+	metricsGatherDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "metrics_gather_duration_seconds",
+		Help: "Duration of the most recent gather of the metrics registry",
+	})
+
+	httpRequestsInFlight = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests currently being served",
+	}, func() float64 { return float64(inFlight.Load()) })
+
+	http2ActiveStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http2_active_streams",
+		Help: "Number of HTTP/2 streams currently being served, across all connections",
+	})
+
+	tlsHandshakeDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tls_handshake_duration_seconds",
+		Help:    "Duration of successful TLS handshakes, from the ClientHello to the verified connection",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 12),
+	})
+
+	httpConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_connections",
+		Help: "Number of client connections by their current state",
+	}, []string{"state"})
+
+	httpConnectionStatesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_connection_states_total",
+		Help: "Count of client connections entering each state",
+	}, []string{"state"})
+
+	longPollWaiters = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "longpoll_waiters",
+		Help: "Number of /longpoll requests waiting for a notification",
+	})
+
+	sseConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sse_connections",
+		Help: "Number of clients currently streaming /events",
+	})
+
+	dnsLookupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dns_lookup_duration_seconds",
+		Help:    "Duration of DNS lookups made by the dns-lookup handler, by whether they succeeded",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"outcome"})
+
+	httpRequestsRate = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_rate",
+		Help: "HTTP requests per second over the last -requests-rate-window, the same as rate(http_requests_total) in PromQL",
+	})
+
+	httpSizeRatio = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_size_ratio",
+		Help:    "Ratio of response bytes to approximate request bytes of HTTP requests",
+		Buckets: prometheus.ExponentialBuckets(0.001, 10, 8),
+	}, []string{"handler"})
+
+	httpRequestsByAgentTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_by_agent_total",
+		Help: "Count of all HTTP requests by the class of their User-Agent: browser, curl, prometheus or other",
+	}, []string{"user_agent"})
+
+	httpClientRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_requests_total",
+		Help: "Count of outbound HTTP requests made by the app, such as those forwarded by /proxy",
+	}, []string{"code", "method"})
+
+	httpClientRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "http_client_request_duration_seconds",
+		Help: "Duration of outbound HTTP requests until the response headers arrived",
+	}, []string{"code", "method"})
+
+	httpClientRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_client_requests_in_flight",
+		Help: "Number of outbound HTTP requests currently waiting for a response",
+	})
+
+	memorySpikeBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "memory_spike_bytes",
+		Help: "Bytes currently held by /memory-spike requests",
+	})
+
+	memoryPressure = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "memory_pressure",
+		Help: "1 while the heap is above -mem-high-watermark-mb and memory-hungry requests are rejected, 0 otherwise",
+	})
+
+	memoryPressureRejectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "memory_pressure_rejections_total",
+		Help: "Count of memory-hungry requests rejected with 503 while memory was low",
+	}, []string{"handler"})
+
+	leakedGoroutinesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "leaked_goroutines_total",
+		Help: "Count of goroutines deliberately leaked by /leak-goroutine, including those released since",
+	})
+
+	workerPoolQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "worker_pool_queue_depth",
+		Help: "Number of expensive requests waiting for a free worker of the -worker-pool-size pool",
+	})
+
+	workerPoolActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "worker_pool_active",
+		Help: "Number of workers of the -worker-pool-size pool currently serving a request",
+	})
+
+	httpRequestsShedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_shed_total",
+		Help: "Count of expensive HTTP requests rejected with 503 because too many requests were in flight",
+	}, []string{"handler"})
+
+	httpRequestsTimedOutTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_timed_out_total",
+		Help: "Count of HTTP requests answered with 504 because the handler took longer than its timeout",
+	}, []string{"handler"})
+
+	waitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wait_seconds",
+		Help:    "Time actually spent waiting in the wait handler, by whether the wait completed, the client cancelled it or shutdown cut it short",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 8),
+	}, []string{"outcome"})
+
+	waitRequested = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "wait_requested_seconds",
+		Help:    "Wait durations requested from the wait handler, regardless of how long the wait actually lasted",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 8),
+	})
+
+	httpClientDisconnectsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_disconnects_total",
+		Help: "Count of responses that could not be written because the client disconnected",
+	}, []string{"handler"})
+
+	httpRequestsSLOTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_slo_total",
+		Help: "Count of HTTP requests subject to the latency SLO",
+	}, []string{"handler"})
+
+	httpRequestsSLOViolationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_slo_violations_total",
+		Help: "Count of HTTP requests that took longer than the latency SLO",
+	}, []string{"handler"})
+
+	goroutinesPeak = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "goroutines_peak",
+		Help: "Highest number of goroutines observed since the process started",
+	})
+
+	schedulerJitter = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "scheduler_jitter_seconds",
+		Help:    "How much later than requested a sleeping goroutine was woken up",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 12),
+	})
+
+	httpRequestsMemstatsSampledTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_memstats_sampled_total",
+		Help: "Count of requests sampled by -per-request-memstats",
+	}, []string{"handler"})
+
+	httpRequestsWithGCTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_with_gc_total",
+		Help: "Count of sampled requests during which at least one garbage collection ran",
+	}, []string{"handler"})
+
+	httpRequestGCPauseSecondsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_request_gc_pause_seconds_total",
+		Help: "Total stop-the-world GC pause time during sampled requests",
+	}, []string{"handler"})
+
+	hashAllocBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "hash_alloc_bytes",
+		Help:    "Bytes allocated while serving a /hash request",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 10),
+	})
+
+	ordersTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orders_total",
+		Help: "Count of simulated orders placed",
+	})
+
+	orderValueDollars = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "order_value_dollars",
+		Help:    "Value of simulated orders",
+		Buckets: []float64{5, 10, 25, 50, 100, 250, 500, 1000},
+	})
+
+	demoSine = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "demo_sine",
+		Help: "A sine wave over time, for building demo dashboards",
+	})
+
+	dbPoolInUse = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "db_pool_in_use",
+		Help: "Number of simulated database connections currently in use",
+	})
+
+	dbPoolWaiters = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "db_pool_waiters",
+		Help: "Number of requests waiting for a simulated database connection",
+	})
+
+	dbQueryDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "db_query_duration_seconds",
+		Help: "Duration of simulated database queries, including the wait for a connection",
+	})
 )
 
+const openFDsInterval = 15 * time.Second
+
 func main() {
+	startTime := time.Now()
 	version.Set(1)
+	goInfo.Set(1)
 	bind := ""
+	bindNetwork := "tcp"
+	systemdSocket := false
 	enableH2c := false
+	tlsCert := ""
+	tlsKey := ""
+	http3Bind := ""
+	disableKeepAlives := false
+	maxHeaderBytes := http.DefaultMaxHeaderBytes
+	reusePort := false
+	listenBacklog := 0
+	sloLatency := time.Duration(0)
+	requestTimeout := time.Duration(0)
+	handlerTimeouts := durationMap{}
+	staticDir := ""
+	staticPrefix := "/static/"
+	enableAdmin := false
+	enableChaos := false
+	quiet := false
+	slowRequests := 20
+	slowRequestThreshold := 100 * time.Millisecond
+	cardinalityLimit := 10000
+	strictCardinality := false
+	disableEndpoints := ""
+	demoBusinessMetrics := false
+	demoSineMetric := false
+	demoSinePeriod := 10 * time.Minute
+	demoSineAmplitude := 1.0
+	faultErrorRate := 0.0
+	flakySequence := "200,200,500,503"
+	faultLatency := time.Duration(0)
+	shutdownTimeout := 30 * time.Second
+	panicDumpDir := ""
+	startupDelay := time.Duration(0)
+	shutdownDrainConnections := false
+	defaultWait := 5
+	defaultHashMB := 5
+	defaultHashIterations := 5
+	hashMaxParallel := 4
+	hashDeterministic := false
+	hashSeed := int64(1)
+	measureAlloc := false
+	perRequestMemstats := false
+	perRequestMemstatsRate := 100
+	hashProfile := false
+	maxInFlight := 0
+	memHighWatermarkMB := 0
+	workerPoolSize := 0
+	workerPoolQueue := 10
+	memLowWatermarkMB := 0
+	burnMaxDuration := 10 * time.Minute
+	eventsInterval := time.Second
+	requestsRateWindow := 10 * time.Second
+	longPollTimeout := 30 * time.Second
+	payloadMaxBytes := int64(100 * 1024 * 1024)
+	dbPoolSize := 10
+	dbPoolWaitTimeout := time.Second
+	limits := loadLimits{maxCPU: 10 * time.Second, maxMemMB: 512, maxSleep: 60 * time.Second}
+	metricsNoCompression := false
+	responseSizeBuckets := "100,1000,10000,100000,1e6,1e7,1e8"
+	metricsBearerToken := ""
+	metricsETag := false
+	metricsReadyDelay := time.Duration(0)
+	dumpMetricsOnExit := ""
+	greeting := "Hello from example application."
+	greetingContentType := "text/plain; charset=utf-8"
+	dnsLookupAllow := ""
+	proxyAllow := ""
+	proxyTimeout := 30 * time.Second
+	echoHeaders := "X-Forwarded-For,X-Forwarded-Host,X-Forwarded-Proto,X-Forwarded-Port,X-Real-Ip"
+	otlpMetricsEndpoint := ""
+	jobName := ""
+	deployment := ""
+	instance, _ := os.Hostname()
+	enableGzip := false
+	gzipLevel := gzip.DefaultCompression
+	enableAccessLog := false
+	logSampling := logSampler{rate: 1}
+	trustedProxies := ""
+	responseHeaders := headerFlag{}
+	forceResponseHeaders := headerFlag{}
+	otlpMetricsInterval := 30 * time.Second
+	otlpTracesEndpoint := ""
 	flagset := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-	flagset.StringVar(&bind, "bind", ":8080", "The socket to bind to.")
+	flagset.StringVar(&bind, "bind", ":8080", "The socket to bind to. A comma-separated list serves the same endpoints on every address.")
+	flagset.StringVar(&bindNetwork, "bind-network", bindNetwork, "Address family to listen on: tcp listens on both IPv4 and IPv6 where the address allows it, tcp4 and tcp6 only on one.")
+	flagset.BoolVar(&systemdSocket, "systemd-socket", false, "Serve on the sockets passed by systemd socket activation instead of binding -bind. Linux only.")
 	flagset.BoolVar(&enableH2c, "h2c", false, "Enable h2c (http/2 over tcp) protocol.")
+	flagset.StringVar(&tlsCert, "tls-cert", "", "Path to the TLS certificate. Serves HTTPS when set together with -tls-key. The certificate is reloaded when the files change.")
+	flagset.StringVar(&tlsKey, "tls-key", "", "Path to the TLS private key.")
+	flagset.StringVar(&http3Bind, "http3-bind", "", "The UDP socket to serve HTTP/3 (QUIC) on. Requires -tls-cert and -tls-key.")
+	flagset.IntVar(&defaultWait, "default-wait", defaultWait, "Seconds /wait waits when the path does not say how long.")
+	flagset.IntVar(&defaultHashMB, "default-hash-mb", defaultHashMB, "Megabytes /hash hashes when the path does not say how many.")
+	flagset.IntVar(&defaultHashIterations, "default-hash-iterations", defaultHashIterations, "Times /hash hashes when the path does not say how often.")
+	flagset.IntVar(&hashMaxParallel, "hash-max-parallel", 4, "Maximum number of goroutines a single /hash request may use via ?parallel=N. Also bounded by GOMAXPROCS.")
+	flagset.BoolVar(&hashDeterministic, "hash-deterministic", false, "Hash a seeded math/rand stream instead of crypto/rand so repeated runs do identical work. For benchmarking only.")
+	flagset.Int64Var(&hashSeed, "hash-seed", 1, "Seed used by -hash-deterministic.")
+	flagset.BoolVar(&measureAlloc, "measure-alloc", false, "Record the bytes allocated by each /hash request in hash_alloc_bytes. Briefly stops the world twice per request.")
+	flagset.BoolVar(&hashProfile, "hash-profile", false, "Allow /hash?profile=cpu to record a CPU profile of the request to a temporary file on the server.")
+	flagset.BoolVar(&perRequestMemstats, "per-request-memstats", false, "Sample requests and record whether a garbage collection ran while they were served. Each sample briefly stops the world twice.")
+	flagset.IntVar(&perRequestMemstatsRate, "per-request-memstats-rate", perRequestMemstatsRate, "Sample 1 in this many requests with -per-request-memstats.")
+	flagset.IntVar(&maxInFlight, "max-inflight", 0, "Reject expensive requests (/wait, /hash, /load, /burn, /payload, /memory-spike) with 503 while more requests than this are in flight. 0 disables shedding.")
+	flagset.IntVar(&workerPoolSize, "worker-pool-size", 0, "Run expensive requests (/hash, /load, /burn) on a pool of this many workers shared by all of them. 0 runs them directly.")
+	flagset.IntVar(&workerPoolQueue, "worker-pool-queue", workerPoolQueue, "Number of expensive requests that may wait for a free worker with -worker-pool-size. Further requests are rejected with 503.")
+	flagset.IntVar(&memHighWatermarkMB, "mem-high-watermark-mb", 0, "Reject memory-hungry requests (/hash, /load, /payload, /memory-spike) with 503 once the heap grows beyond this many megabytes. 0 disables the check.")
+	flagset.IntVar(&memLowWatermarkMB, "mem-low-watermark-mb", 0, "Accept memory-hungry requests again once the heap has shrunk below this many megabytes. Defaults to 80% of -mem-high-watermark-mb.")
+	flagset.DurationVar(&limits.maxCPU, "load-max-cpu", limits.maxCPU, "Maximum CPU time a single /load request may burn.")
+	flagset.IntVar(&limits.maxMemMB, "load-max-mem-mb", limits.maxMemMB, "Maximum memory in megabytes a single /load request may allocate.")
+	flagset.DurationVar(&limits.maxSleep, "load-max-sleep", limits.maxSleep, "Maximum time a single /load request may sleep.")
+	flagset.DurationVar(&burnMaxDuration, "burn-max-duration", burnMaxDuration, "Maximum duration a single /burn/{percent}/{seconds} request may run for.")
+	flagset.DurationVar(&requestsRateWindow, "requests-rate-window", requestsRateWindow, "Window over which http_requests_rate is computed.")
+	flagset.DurationVar(&eventsInterval, "events-interval", eventsInterval, "Interval between the tick events streamed by /events.")
+	flagset.DurationVar(&longPollTimeout, "longpoll-timeout", longPollTimeout, "How long /longpoll waits for POST /admin/notify before answering 204.")
+	flagset.Int64Var(&payloadMaxBytes, "payload-max-bytes", payloadMaxBytes, "Maximum response size in bytes that /payload/{bytes} may be asked for.")
+	flagset.IntVar(&dbPoolSize, "db-pool-size", dbPoolSize, "Number of connections in the simulated database pool behind /db-query/{ms}.")
+	flagset.DurationVar(&dbPoolWaitTimeout, "db-pool-wait-timeout", dbPoolWaitTimeout, "How long /db-query/{ms} waits for a free simulated connection before answering 503.")
+	flagset.StringVar(&responseSizeBuckets, "response-size-buckets", responseSizeBuckets, "Comma-separated, increasing bucket upper bounds in bytes for http_response_size_bytes.")
+	flagset.BoolVar(&metricsNoCompression, "metrics-no-compression", false, "Never gzip /metrics responses, e.g. when a proxy in front takes care of compression.")
+	flagset.StringVar(&dumpMetricsOnExit, "dump-metrics-on-exit", "", "After a graceful shutdown, write all metrics in the text format to this file, or to stdout if it is -. Disabled when empty.")
+	flagset.DurationVar(&metricsReadyDelay, "metrics-ready-delay", 0, "Answer /metrics with 503 for this long after startup, to test scrape retries.")
+	flagset.BoolVar(&metricsETag, "metrics-etag", false, "Send an ETag with /metrics responses and answer 304 when a scrape's If-None-Match still matches. Buffers every scrape in memory.")
+	flagset.StringVar(&metricsBearerToken, "metrics-bearer-token", "", "Require scrapes of /metrics to send \"Authorization: Bearer <token>\" with this token. Disabled when empty.")
+	flagset.StringVar(&greeting, "greeting", greeting, "The message served by the root handler.")
+	flagset.StringVar(&greetingContentType, "greeting-content-type", greetingContentType, "Content type of the root handler's response. With application/json the greeting is wrapped as {\"message\": ...}.")
+	flagset.StringVar(&dnsLookupAllow, "dns-lookup-allow", "", "Comma-separated hosts that /dns-lookup/{host} may resolve. *.example.com allows all subdomains. Nothing may be resolved when empty.")
+	flagset.StringVar(&proxyAllow, "proxy-allow", "", "Comma-separated hosts that /proxy?url=... may fetch from. *.example.com allows all subdomains. Nothing may be fetched when empty.")
+	flagset.DurationVar(&proxyTimeout, "proxy-timeout", proxyTimeout, "How long /proxy waits for the target, including reading its response.")
+	flagset.StringVar(&echoHeaders, "echo-headers", echoHeaders, "Comma-separated request headers that /headers/echo reflects back as X-Echo-* response headers.")
+	flagset.BoolVar(&enableGzip, "gzip", false, "Compress responses for clients that accept gzip.")
+	flagset.IntVar(&gzipLevel, "gzip-level", gzipLevel, "Compression level for -gzip, from 1 (fastest) to 9 (smallest), or -1 for the default trade-off.")
+	flagset.BoolVar(&enableAccessLog, "access-log", false, "Log every request to stderr.")
+	flagset.IntVar(&logSampling.rate, "log-sample-rate", logSampling.rate, "Only write 1 in this many successful requests to the access log. Requests answered with 4xx or 5xx are always logged.")
+	flagset.BoolVar(&logSampling.random, "log-sample-random", false, "Pick the successful requests kept by -log-sample-rate at random instead of keeping every n-th one.")
+	flagset.StringVar(&trustedProxies, "trusted-proxies", "", "Comma-separated addresses or CIDRs of proxies whose X-Forwarded-For and X-Real-IP headers are trusted for the client address.")
+	flagset.Var(responseHeaders, "response-headers", "Header to add to every response that does not set it itself, as Key:Value, e.g. X-Frame-Options:DENY. Repeatable.")
+	flagset.Var(forceResponseHeaders, "force-response-headers", "Like -response-headers, but replaces the header even if the handler set it. Repeatable.")
+	flagset.StringVar(&jobName, "job-name", "", "Add a job label with this value, and an instance label, to every metric, e.g. when pushing them somewhere that does not add target labels. Disabled when empty.")
+	flagset.StringVar(&instance, "instance", instance, "Value of the instance label added with -job-name.")
+	flagset.StringVar(&deployment, "deployment", "", "Add a deployment label with this value, such as blue, green or canary, to every metric, to tell deployments apart during rollouts. Disabled when empty.")
+	flagset.StringVar(&otlpMetricsEndpoint, "otlp-metrics-endpoint", "", "OTLP/HTTP endpoint URL to also push metrics to, e.g. http://localhost:4318/v1/metrics. Disabled when empty.")
+	flagset.DurationVar(&otlpMetricsInterval, "otlp-metrics-interval", 30*time.Second, "Interval between OTLP metric pushes.")
+	flagset.StringVar(&otlpTracesEndpoint, "otlp-traces-endpoint", "", "OTLP/HTTP endpoint URL to push the spans of /trace-test to, e.g. http://localhost:4318/v1/traces. Tracing is disabled when empty.")
+	flagset.BoolVar(&reusePort, "reuseport", false, "Set SO_REUSEPORT on the listening socket so a new process can bind the same port before the old one exits. Linux only.")
+	flagset.IntVar(&maxHeaderBytes, "max-header-bytes", maxHeaderBytes, "Maximum size in bytes of the request line and headers. Larger requests are rejected with 431.")
+	flagset.IntVar(&listenBacklog, "listen-backlog", 0, "Length of the queue of connections waiting to be accepted. 0 keeps the system default. Linux only.")
+	flagset.BoolVar(&disableKeepAlives, "disable-keepalives", false, "Close the connection after every request, forcing clients to reconnect.")
+	flagset.DurationVar(&requestTimeout, "request-timeout", 0, "Answer 504 for requests still being handled after this long. The streaming handlers events, payload and longpoll are exempt. 0 disables the timeout.")
+	flagset.Var(handlerTimeouts, "handler-timeout", "Override -request-timeout for one handler, as name=duration, e.g. hash=2m. Repeatable.")
+	flagset.DurationVar(&sloLatency, "slo-latency", 0, "Requests slower than this count as latency SLO violations in http_requests_slo_violations_total. 0 disables the SLO counters.")
+	flagset.StringVar(&staticDir, "static-dir", "", "Directory to serve static files from under -static-prefix. Disabled when empty.")
+	flagset.StringVar(&staticPrefix, "static-prefix", staticPrefix, "URL path prefix that -static-dir is served under.")
+	flagset.BoolVar(&demoBusinessMetrics, "demo-business-metrics", false, "Simulate orders in the background and expose them as orders_total and order_value_dollars.")
+	flagset.BoolVar(&demoSineMetric, "demo-sine-metric", false, "Expose demo_sine, a gauge following a sine wave over time.")
+	flagset.DurationVar(&demoSinePeriod, "demo-sine-period", demoSinePeriod, "Period of the demo_sine wave.")
+	flagset.Float64Var(&demoSineAmplitude, "demo-sine-amplitude", demoSineAmplitude, "Amplitude of the demo_sine wave.")
+	flagset.StringVar(&disableEndpoints, "disable-endpoints", "", "Comma-separated handler names, as in the handler label, whose endpoints answer 404 as if they did not exist, e.g. hash,load,panic.")
+	flagset.BoolVar(&enableAdmin, "enable-admin", false, "Serve the /admin/ endpoints that change the app's behaviour at runtime.")
+	flagset.IntVar(&cardinalityLimit, "cardinality-limit", cardinalityLimit, "Warn at startup when the request metrics are estimated to grow beyond this many series. 0 disables the check.")
+	flagset.BoolVar(&strictCardinality, "strict-cardinality", false, "Refuse to start instead of warning when -cardinality-limit is exceeded.")
+	flagset.IntVar(&slowRequests, "slow-requests", slowRequests, "Number of the slowest requests that GET /admin/slow-requests lists. 0 disables the list.")
+	flagset.DurationVar(&slowRequestThreshold, "slow-request-threshold", slowRequestThreshold, "Requests taking at least this long are listed by /admin/slow-requests.")
+	flagset.BoolVar(&quiet, "quiet", false, "Do not log the JSON summary of the effective settings at startup.")
+	flagset.BoolVar(&enableChaos, "enable-chaos", false, "Serve endpoints that deliberately harm the process, such as /leak-goroutine and /deadlock/{ms}. Never enable this in production.")
+	flagset.StringVar(&flakySequence, "flaky-sequence", flakySequence, "Comma-separated status codes that successive /flaky calls answer with in turn, repeating.")
+	flagset.Float64Var(&faultErrorRate, "fault-error-rate", 0, "Fraction of requests, between 0 and 1, that fail with an injected 500. Adjustable at runtime via /admin/fault.")
+	flagset.DurationVar(&faultLatency, "fault-latency", 0, "Latency injected before every request. Adjustable at runtime via /admin/fault.")
+	flagset.DurationVar(&startupDelay, "startup-delay", 0, "Simulated warmup: /startupz and /readyz fail for this long after the listeners are up.")
+	flagset.StringVar(&panicDumpDir, "panic-dump-dir", "", "Directory to write a dump of all goroutine stacks to whenever a handler panics. Disabled when empty.")
+	flagset.DurationVar(&shutdownTimeout, "shutdown-timeout", shutdownTimeout, "How long to wait for in-flight requests to finish on SIGINT or SIGTERM.")
+	flagset.BoolVar(&shutdownDrainConnections, "shutdown-drain-connections", false, "Tell long-running handlers such as /wait to wrap up as soon as shutdown begins instead of running to completion.")
 	flagset.Parse(os.Args[1:])
 
-	r := prometheus.NewRegistry()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sizeBuckets, err := parseBuckets(responseSizeBuckets)
+	if err != nil {
+		log.Fatalf("-response-size-buckets: %v", err)
+	}
+	httpResponseSize := newResponseSizeHistogram(sizeBuckets)
+
+	registry := prometheus.NewRegistry()
+	if strings.IndexFunc(deployment, func(c rune) bool { return !unicode.IsLetter(c) && !unicode.IsDigit(c) }) >= 0 {
+		log.Fatalf("-deployment must only contain letters and digits, not %q", deployment)
+	}
+	constLabels := targetLabels(jobName, instance, deployment)
+	r := prometheus.WrapRegistererWith(constLabels, registry)
+	// Metrics about the process rather than the app live in a registry of
+	// their own, exposed on /metrics/internal and merged into /metrics/all.
+	internalRegistry := prometheus.NewRegistry()
+	prometheus.WrapRegistererWith(constLabels, internalRegistry).MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 	r.MustRegister(httpRequestsTotal)
 	r.MustRegister(httpRequestDuration)
+	r.MustRegister(httpResponseSize)
+	r.MustRegister(httpSizeRatio)
+	r.MustRegister(configGauges([]configValue{
+		{"request_timeout_seconds", "request-timeout", requestTimeout.Seconds()},
+		{"shutdown_timeout_seconds", "shutdown-timeout", shutdownTimeout.Seconds()},
+		{"slo_latency_seconds", "slo-latency", sloLatency.Seconds()},
+		{"max_inflight", "max-inflight", float64(maxInFlight)},
+		{"max_header_bytes", "max-header-bytes", float64(maxHeaderBytes)},
+		{"hash_max_parallel", "hash-max-parallel", float64(hashMaxParallel)},
+		{"load_max_cpu_seconds", "load-max-cpu", limits.maxCPU.Seconds()},
+		{"load_max_mem_bytes", "load-max-mem-mb", float64(limits.maxMemMB) * 1024 * 1024},
+		{"load_max_sleep_seconds", "load-max-sleep", limits.maxSleep.Seconds()},
+		{"payload_max_bytes", "payload-max-bytes", float64(payloadMaxBytes)},
+		{"db_pool_size", "db-pool-size", float64(dbPoolSize)},
+		{"response_size_buckets", "response-size-buckets", float64(len(sizeBuckets))},
+	})...)
 	r.MustRegister(version)
+	r.MustRegister(goInfo)
+	r.MustRegister(goGoroutines)
+	r.MustRegister(metricsGatherDuration)
+	r.MustRegister(httpRequestsInFlight)
+	r.MustRegister(http2ActiveStreams)
+	r.MustRegister(httpRequestsByAgentTotal)
+	r.MustRegister(httpConnections)
+	r.MustRegister(httpConnectionStatesTotal)
+	r.MustRegister(httpRequestsShedTotal)
+	r.MustRegister(httpRequestsTimedOutTotal)
+	r.MustRegister(waitDuration)
+	r.MustRegister(waitRequested)
+	r.MustRegister(longPollWaiters)
+	r.MustRegister(memorySpikeBytes)
+	r.MustRegister(sseConnections)
+	r.MustRegister(dnsLookupDuration)
+	r.MustRegister(httpClientRequestsTotal, httpClientRequestDuration, httpClientRequestsInFlight)
+	r.MustRegister(httpClientDisconnectsTotal)
+	if measureAlloc {
+		r.MustRegister(hashAllocBytes)
+	}
+	if demoBusinessMetrics {
+		r.MustRegister(ordersTotal)
+		r.MustRegister(orderValueDollars)
+		go simulateOrders(ctx, time.Second)
+	}
+	if demoSineMetric {
+		if demoSinePeriod <= 0 {
+			log.Fatal("-demo-sine-period must be positive")
+		}
+		r.MustRegister(demoSine)
+		go simulateSine(ctx, demoSinePeriod, demoSineAmplitude, time.Second)
+	}
+	r.MustRegister(dbPoolInUse)
+	r.MustRegister(dbPoolWaiters)
+	r.MustRegister(dbQueryDuration)
+	if sloLatency > 0 {
+		r.MustRegister(httpRequestsSLOTotal)
+		r.MustRegister(httpRequestsSLOViolationsTotal)
+	}
+	if requestsRateWindow <= 0 {
+		log.Fatal("-requests-rate-window must be positive")
+	}
+	r.MustRegister(httpRequestsRate)
+	go trackRequestRate(ctx, requestsRateWindow)
+	r.MustRegister(goroutinesPeak)
+	go trackGoroutinePeak(ctx, goroutinePeakInterval)
+	r.MustRegister(schedulerJitter)
+	jitter := &jitterMonitor{}
+	go jitter.run(ctx)
+	if _, err := countOpenFDs(); err == nil {
+		r.MustRegister(openFDs)
+		go updateOpenFDs(ctx, openFDsInterval)
+	}
 
-	foundHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Hello from example application."))
-	})
+	var meterProvider *sdkmetric.MeterProvider
+	if otlpMetricsEndpoint != "" {
+		var err error
+		meterProvider, err = startOTLPMetricsExport(ctx, otlpMetricsEndpoint, otlpMetricsInterval, registry)
+		if err != nil {
+			log.Fatalf("failed to set up OTLP metrics export: %v", err)
+		}
+	}
+	var (
+		tracerProvider   *sdktrace.TracerProvider
+		traceTestHandler = newTraceTestHandler(nil)
+	)
+	if otlpTracesEndpoint != "" {
+		var err error
+		tracerProvider, err = startOTLPTraceExport(ctx, otlpTracesEndpoint)
+		if err != nil {
+			log.Fatalf("failed to set up OTLP trace export: %v", err)
+		}
+		traceTestHandler = newTraceTestHandler(tracerProvider)
+	}
+
+	foundHandler := newFoundHandler(greeting, greetingContentType)
 	notfoundHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 	})
@@ -63,77 +584,464 @@ func main() {
 		w.WriteHeader(http.StatusInternalServerError)
 	})
 
-	waitHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		waitSecStr := r.PathValue("waitSec")
-		waitSec, _ := strconv.Atoi(waitSecStr)
-		if waitSec < 1 {
-			waitSec = 5 // errors, no value, and negative values all default to 5 seconds
+	if memHighWatermarkMB > 0 && memLowWatermarkMB >= memHighWatermarkMB {
+		log.Fatal("-mem-low-watermark-mb must be below -mem-high-watermark-mb")
+	}
+	memGuard := newMemoryGuard(memHighWatermarkMB, memLowWatermarkMB)
+	if memGuard != nil {
+		r.MustRegister(memoryPressure, memoryPressureRejectionsTotal)
+		go memGuard.watch(ctx, time.Second)
+	}
+	pool := newWorkerPool(workerPoolSize, workerPoolQueue)
+	if pool != nil {
+		r.MustRegister(workerPoolQueueDepth, workerPoolActive)
+	}
+	for name, v := range map[string]int{"default-wait": defaultWait, "default-hash-mb": defaultHashMB, "default-hash-iterations": defaultHashIterations, "hash-max-parallel": hashMaxParallel} {
+		if v < 1 {
+			log.Fatalf("-%s must be at least 1", name)
 		}
-		time.Sleep(time.Duration(waitSec) * time.Second)
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Waited for " + waitSecStr + " seconds."))
-	})
+	}
+	waitHandler := shedLoad("wait", maxInFlight, newWaitHandler(defaultWait))
+	loadHandler := memGuard.protect("load", shedLoad("load", maxInFlight, pool.wrap(newLoadHandler(limits))))
+	burnHandler := shedLoad("burn", maxInFlight, pool.wrap(newBurnHandler(burnMaxDuration)))
+	memorySpikeHandler := memGuard.protect("memory-spike", shedLoad("memory-spike", maxInFlight, newMemorySpikeHandler(limits)))
+	payloadHandler := memGuard.protect("payload", shedLoad("payload", maxInFlight, newPayloadHandler(payloadMaxBytes)))
+	redirectHandler := newRedirectHandler()
+	hashHandler := memGuard.protect("hash", shedLoad("hash", maxInFlight, pool.wrap(newHashHandler(hashConfig{
+		defaultMB:         defaultHashMB,
+		defaultIterations: defaultHashIterations,
+		maxParallel:       hashMaxParallel,
+		source:            randomSource(hashDeterministic, hashSeed),
+		measureAlloc:      measureAlloc,
+		allowProfile:      hashProfile,
+	}))))
+
+	faults := &faultInjector{}
+	if err := faults.set(faultSettings{ErrorRate: faultErrorRate, LatencyMillis: faultLatency.Milliseconds()}); err != nil {
+		log.Fatalf("invalid fault injection settings: %v", err)
+	}
+	maintenance := &maintenanceMode{}
+	health := &probes{maintenance: maintenance}
+	notifications := newBroadcast()
+	go health.beat(ctx, heartbeatInterval)
+	inst := instrumenter{sloLatency: sloLatency, faults: faults, timeouts: handlerTimeouts, defaultTimeout: requestTimeout, responseSize: httpResponseSize, panicDumpDir: panicDumpDir, maintenance: maintenance, names: map[string]bool{}}
+	if enableAdmin {
+		inst.slow = newSlowRequestLog(slowRequests, slowRequestThreshold)
+	}
+	if perRequestMemstats {
+		r.MustRegister(httpRequestsMemstatsSampledTotal, httpRequestsWithGCTotal, httpRequestGCPauseSecondsTotal)
+		inst.gc = &gcAttribution{rate: perRequestMemstatsRate}
+	}
+	inst.disabled = map[string]bool{}
+	for _, name := range splitList(disableEndpoints) {
+		inst.disabled[name] = true
+	}
+	// Every route but the catch-all names its methods, GET including HEAD,
+	// so that OPTIONS answers list only the methods a route serves.
+	mux := newRouter()
+	mux.Handle("GET /{$}", inst.instrument("found", foundHandler))
+	mux.Handle("/", inst.instrument(unmatchedHandler, unmatchedRoute))
+	mux.Handle("GET /startupz", inst.instrument("startupz", health.startupHandler()))
+	mux.Handle("GET /healthz", inst.instrument("healthz", health.livenessHandler()))
+	mux.Handle("GET /readyz", inst.instrument("readyz", health.readinessHandler()))
+	mux.Handle("GET /err", inst.instrument("err", notfoundHandler))
+	mux.Handle("GET /internal-err", inst.instrument("internal-err", internalErrorHandler))
+	for _, p := range waitPatterns {
+		mux.Handle(p, inst.instrument("wait", waitHandler))
+	}
+	for _, p := range hashPatterns {
+		mux.Handle(p, inst.instrument("hash", hashHandler))
+	}
+	mux.Handle("GET /selftest/hash", inst.instrument("selftest-hash", newHashSelftestHandler()))
+	mux.Handle("GET /payload/{bytes}", inst.instrument("payload", payloadHandler))
+	if dbPoolSize < 1 {
+		log.Fatal("-db-pool-size must be at least 1")
+	}
+	if dbPoolWaitTimeout <= 0 {
+		log.Fatal("-db-pool-wait-timeout must be positive")
+	}
+	mux.Handle("GET /db-query/{ms}", inst.instrument("db-query", newDBQueryHandler(newDBPool(dbPoolSize, dbPoolWaitTimeout))))
+	mux.Handle("GET /redirect/{code}/{location...}", inst.instrument("redirect", redirectHandler))
+	mux.Handle("GET /redirect/{code}", inst.instrument("redirect", redirectHandler))
+	mux.Handle("GET /redirect", inst.instrument("redirect", redirectHandler))
+	mux.Handle("GET /burn/{percent}/{seconds}", inst.instrument("burn", burnHandler))
+	mux.Handle("GET /fake-targets", inst.instrument("fake-targets", newFakeTargetsHandler(startTime)))
+	mux.Handle("GET /limits", inst.instrument("limits", newLimitsHandler()))
+	mux.Handle("GET /trace-test", inst.instrument("trace-test", traceTestHandler))
+	mux.Handle("GET /jitter", inst.instrument("jitter", jitter.handler()))
+	mux.Handle("GET /longpoll", inst.instrument("longpoll", notifications.longPollHandler(longPollTimeout)))
+	if eventsInterval <= 0 {
+		log.Fatal("-events-interval must be positive")
+	}
+	mux.Handle("GET /events", inst.instrument("events", newEventsHandler(eventsInterval)))
+	// Replayed requests go through the middleware around mux, which is only
+	// built below, so that they are counted, shed and logged like any other.
+	var appHandler http.Handler
+	mux.Handle("POST /replay", inst.instrument("replay", newReplayHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		appHandler.ServeHTTP(w, r)
+	}))))
+	mux.Handle("GET /panic", inst.instrument("panic", newPanicHandler()))
+	mux.Handle("GET /dns-lookup/{host}", inst.instrument("dns-lookup", newDNSLookupHandler(splitList(dnsLookupAllow))))
+	mux.Handle("GET /proxy", inst.instrument("proxy", newProxyHandler(newOutboundClient(proxyTimeout), splitList(proxyAllow))))
+	flakyCodes, err := parseStatusCodes(flakySequence)
+	if err != nil {
+		log.Fatalf("-flaky-sequence: %v", err)
+	}
+	mux.Handle("GET /flaky", inst.instrument("flaky", newFlakyHandler(flakyCodes)))
+	mux.Handle("GET /deadline", inst.instrument("deadline", newDeadlineHandler()))
+	mux.Handle("GET /load", inst.instrument("load", loadHandler))
+	mux.Handle("GET /memory-spike/{mb}/{holdms}", inst.instrument("memory-spike", memorySpikeHandler))
+	mux.Handle("GET /headers/echo", inst.instrument("headers-echo", newHeadersEchoHandler(splitList(echoHeaders))))
+	if staticDir != "" {
+		prefix := "/" + strings.Trim(staticPrefix, "/") + "/"
+		mux.Handle("GET "+prefix, inst.instrument("static", newStaticHandler(prefix, staticDir)))
+	}
+	if enableChaos {
+		r.MustRegister(leakedGoroutinesTotal)
+		leak := newGoroutineLeak()
+		mux.Handle("GET /leak-goroutine", inst.instrument("leak-goroutine", leak.leakHandler()))
+		mux.Handle("GET /leak-goroutine/stop", inst.instrument("leak-goroutine-stop", leak.stopHandler()))
+		mux.Handle("GET /deadlock/{ms}", inst.instrument("deadlock", (&lockOrdering{}).deadlockHandler()))
+	}
+	if enableAdmin {
+		mux.Handle("GET /admin/fault", faults.adminHandler())
+		mux.Handle("POST /admin/fault", faults.adminHandler())
+		mux.Handle("POST /admin/notify", notifications.notifyHandler(1<<20))
+		mux.Handle("POST /admin/fail-liveness", health.failLivenessHandler())
+		mux.Handle("GET /admin/maintenance", maintenance.adminHandler())
+		mux.Handle("POST /admin/maintenance", maintenance.adminHandler())
+		mux.Handle("GET /admin/config", newConfigHandler(flagset))
+		if inst.slow != nil {
+			mux.Handle("GET /admin/slow-requests", inst.slow.adminHandler())
+		}
+	}
+	for name := range inst.names {
+		if !slices.Contains(endpointNames, name) {
+			panic("handler " + name + " is missing from endpointNames")
+		}
+	}
+	if err := checkEndpointNames(slices.Sorted(maps.Keys(inst.disabled))); err != nil {
+		log.Fatalf("-disable-endpoints: %v", err)
+	}
+	if err := checkEndpointNames(slices.Sorted(maps.Keys(handlerTimeouts))); err != nil {
+		log.Fatalf("-handler-timeout: %v", err)
+	}
+	if err := checkCardinality(estimateRequestSeries(len(inst.names)-len(inst.disabled), len(sizeBuckets)), cardinalityLimit, strictCardinality); err != nil {
+		log.Fatal(err)
+	}
+	metricsHandler := newScrapeHandler(registry, metricsNoCompression, metricsETag)
+	metricsHandler = delayMetrics(startTime, metricsReadyDelay, metricsHandler)
+	if metricsBearerToken != "" {
+		metricsHandler = requireBearerToken(metricsBearerToken, metricsHandler)
+	}
+	mux.Handle("GET /metrics", metricsHandler)
+	for path, g := range map[string]prometheus.Gatherer{
+		"/metrics/internal": internalRegistry,
+		"/metrics/all":      prometheus.Gatherers{registry, internalRegistry},
+	} {
+		h := promhttp.HandlerFor(g, promhttp.HandlerOpts{DisableCompression: metricsNoCompression, EnableOpenMetrics: true})
+		if metricsBearerToken != "" {
+			h = requireBearerToken(metricsBearerToken, h)
+		}
+		mux.Handle("GET "+path, h)
+	}
+	metadataHandler := newMetadataHandler(registry)
+	if metricsBearerToken != "" {
+		metadataHandler = requireBearerToken(metricsBearerToken, metadataHandler)
+	}
+	mux.Handle("GET /metadata", metadataHandler)
 
-	hashHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		iterationsStr := r.PathValue("iterations")
-		iterations, _ := strconv.Atoi(iterationsStr)
-		if iterations < 1 {
-			iterations = 5 // errors, no value, and negative values all default to 5 iterations
+	proxies, err := parsePrefixes(splitList(trustedProxies))
+	if err != nil {
+		log.Fatalf("-trusted-proxies: %v", err)
+	}
+	appHandler = addResponseHeaders(http.Header(responseHeaders), http.Header(forceResponseHeaders), handleOptions(mux))
+	if enableGzip {
+		if gzipLevel != gzip.DefaultCompression && (gzipLevel < gzip.BestSpeed || gzipLevel > gzip.BestCompression) {
+			log.Fatalf("-gzip-level must be between %d and %d, or %d", gzip.BestSpeed, gzip.BestCompression, gzip.DefaultCompression)
 		}
-		mbStr := r.PathValue("mb")
-		mb, _ := strconv.Atoi(mbStr)
-		if mb < 1 {
-			mb = 5 // errors, no value, and negative values all default to 5 mb
+		appHandler = gzipResponses(gzipLevel, appHandler)
+	}
+	if enableAccessLog {
+		appHandler = accessLog(proxies, &logSampling, appHandler)
+	}
+	appHandler = trackInFlight(countUserAgents(appHandler))
+	handler := appHandler
+	if enableH2c {
+		handler = h2c.NewHandler(appHandler, &http2.Server{})
+	}
+
+	if (tlsCert == "") != (tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be set together")
+	}
+	var tlsConfig *tls.Config
+	if tlsCert != "" && tlsKey != "" {
+		certs, err := newCertReloader(tlsCert, tlsKey)
+		if err != nil {
+			log.Fatalf("failed to load TLS certificate: %v", err)
 		}
-		fmt.Printf("Hashing %d mb, %d times\n", mb, iterations)
-		start := time.Now()
-		for range iterations {
-			hash := hashRandomData(mb * 1024 * 1024)
-			fmt.Println("completed hash with result: " + hash)
+		// NextProtos is spelled out because the clones made by
+		// observeHandshakes do not see the protocols net/http would add.
+		tlsConfig = &tls.Config{GetCertificate: certs.GetCertificate, NextProtos: []string{"h2", "http/1.1"}}
+		observeHandshakes(tlsConfig)
+		r.MustRegister(tlsHandshakeDuration)
+	}
+	var h3srv *http3.Server
+	if http3Bind != "" {
+		if tlsConfig == nil {
+			log.Fatal("-http3-bind requires -tls-cert and -tls-key")
 		}
-		elapsed := time.Since(start)
+		h3srv = &http3.Server{Addr: http3Bind, Handler: appHandler, TLSConfig: http3.ConfigureTLSConfig(tlsConfig.Clone())}
+		handler = altSvcHandler(h3srv, handler)
+		go func() {
+			if err := h3srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	conns := newConnTracker()
+	var servers []*http.Server
+	errc := make(chan error, 1)
+	switch bindNetwork {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		log.Fatalf("-bind-network must be tcp, tcp4 or tcp6, not %q", bindNetwork)
+	}
+	var listeners []net.Listener
+	if systemdSocket {
+		listeners, err = systemdListeners()
+		if err != nil {
+			log.Fatalf("-systemd-socket: %v", err)
+		}
+	} else {
+		for _, addr := range splitList(bind) {
+			ln, err := listen(bindNetwork, addr, reusePort)
+			if err != nil {
+				log.Fatal(err)
+			}
+			listeners = append(listeners, ln)
+		}
+	}
+	var listening []string
+	for _, ln := range listeners {
+		if listenBacklog > 0 {
+			if err := setListenBacklog(ln, listenBacklog); err != nil {
+				log.Fatalf("failed to set the listen backlog: %v", err)
+			}
+		}
+		log.Printf("listening on %s (%s)", ln.Addr(), listenFamily(bindNetwork, ln.Addr()))
+		listening = append(listening, ln.Addr().String())
+		ln = conns.listener(ln)
+		srv := newServer(ln.Addr().String(), handler, tlsConfig, conns, serverConfig{
+			maxHeaderBytes:    maxHeaderBytes,
+			disableKeepAlives: disableKeepAlives,
+			drainConnections:  shutdownDrainConnections,
+		})
+		servers = append(servers, srv)
+		go func() {
+			var err error
+			if tlsConfig != nil {
+				err = srv.ServeTLS(ln, "", "")
+			} else {
+				err = srv.Serve(ln)
+			}
+			select {
+			case errc <- err:
+			default:
+			}
+		}()
+	}
+	if len(servers) == 0 {
+		log.Fatal("-bind must name at least one address")
+	}
+	if !quiet {
+		protocols := []string{"HTTP/1.1"}
+		if tlsConfig != nil {
+			protocols = append(protocols, "HTTP/2")
+		}
+		if enableH2c {
+			protocols = append(protocols, "h2c")
+		}
+		if h3srv != nil {
+			protocols = append(protocols, "HTTP/3")
+		}
+		logStartupBanner(startupBanner{
+			Version:     appVersion,
+			Listen:      listening,
+			Protocols:   protocols,
+			MetricsPath: "/metrics",
+			MetricsAuth: metricsBearerToken != "",
+			Admin:       enableAdmin,
+			Chaos:       enableChaos,
+			Limits: map[string]any{
+				"max_inflight":      maxInFlight,
+				"request_timeout":   requestTimeout.String(),
+				"max_header_bytes":  maxHeaderBytes,
+				"worker_pool_size":  workerPoolSize,
+				"hash_max_parallel": hashMaxParallel,
+				"payload_max_bytes": payloadMaxBytes,
+				"load_max_cpu":      limits.maxCPU.String(),
+				"load_max_mem_mb":   limits.maxMemMB,
+			},
+		}, flagset)
+	}
+	time.AfterFunc(startupDelay, func() { health.started.Store(true) })
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	log.Print("shutting down")
+	health.draining.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	// Shut the servers down together so that none keeps accepting new
+	// connections while another drains.
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				log.Printf("failed to shut down %s gracefully: %v", srv.Addr, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if h3srv != nil {
+		h3srv.Shutdown(shutdownCtx)
+	}
+	if meterProvider != nil {
+		meterProvider.Shutdown(shutdownCtx)
+	}
+	if tracerProvider != nil {
+		tracerProvider.Shutdown(shutdownCtx)
+	}
+	if dumpMetricsOnExit != "" {
+		if err := dumpMetrics(registry, dumpMetricsOnExit); err != nil {
+			log.Printf("failed to dump metrics: %v", err)
+		}
+	}
+}
+
+// newFoundHandler serves greeting on /, as a JSON message when contentType
+// is application/json.
+func newFoundHandler(greeting, contentType string) http.Handler {
+	body := []byte(greeting)
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/json" {
+		body, _ = json.Marshal(map[string]string{"message": greeting})
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(fmt.Sprintf("Hashing %d mb, %d times took %s", mb, iterations, elapsed)))
+		w.Write(body)
 	})
+}
 
-	foundChain := promhttp.InstrumentHandlerDuration(
-		httpRequestDuration.MustCurryWith(prometheus.Labels{"handler": "found"}),
-		promhttp.InstrumentHandlerCounter(httpRequestsTotal, foundHandler),
-	)
+// newStaticHandler serves the files in dir under prefix. http.Dir rejects
+// paths escaping the directory, and the mux has already redirected any path
+// containing .. to its cleaned form.
+func newStaticHandler(prefix, dir string) http.Handler {
+	return http.StripPrefix(prefix, http.FileServer(http.Dir(dir)))
+}
 
-	mux := http.NewServeMux()
-	mux.Handle("/", foundChain)
-	mux.Handle("/err", promhttp.InstrumentHandlerCounter(httpRequestsTotal, notfoundHandler))
-	mux.Handle("/internal-err", promhttp.InstrumentHandlerCounter(httpRequestsTotal, internalErrorHandler))
-	mux.Handle("/wait/{waitSec}", promhttp.InstrumentHandlerCounter(httpRequestsTotal, waitHandler))
-	mux.Handle("/wait/", promhttp.InstrumentHandlerCounter(httpRequestsTotal, waitHandler))
-	mux.Handle("/hash/{mb}/{iterations}", promhttp.InstrumentHandlerCounter(httpRequestsTotal, hashHandler))
-	mux.Handle("/hash/{mb}", promhttp.InstrumentHandlerCounter(httpRequestsTotal, hashHandler))
-	mux.Handle("/hash/", promhttp.InstrumentHandlerCounter(httpRequestsTotal, hashHandler))
-	mux.Handle("/metrics", promhttp.HandlerFor(r, promhttp.HandlerOpts{}))
-
-	var srv *http.Server
-	if enableH2c {
-		srv = &http.Server{Addr: bind, Handler: h2c.NewHandler(mux, &http2.Server{})}
-	} else {
-		srv = &http.Server{Addr: bind, Handler: mux}
+// serverConfig holds the flags that apply to every HTTP server main starts.
+type serverConfig struct {
+	// maxHeaderBytes is -max-header-bytes.
+	maxHeaderBytes int
+	// disableKeepAlives is -disable-keepalives.
+	disableKeepAlives bool
+	// drainConnections is -shutdown-drain-connections: long-running
+	// handlers are told to wrap up when shutdown begins.
+	drainConnections bool
+}
+
+// newServer returns the server for one listener at addr, serving handler
+// with cfg applied and every connection tracked by conns. tlsConfig is nil
+// for plain HTTP.
+func newServer(addr string, handler http.Handler, tlsConfig *tls.Config, conns *connTracker, cfg serverConfig) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: handler, TLSConfig: tlsConfig, MaxHeaderBytes: cfg.maxHeaderBytes, ConnState: conns.connState}
+	srv.SetKeepAlivesEnabled(!cfg.disableKeepAlives)
+	if cfg.drainConnections {
+		srv.RegisterOnShutdown(beginShutdown)
 	}
+	return srv
+}
 
-	log.Fatal(srv.ListenAndServe())
+// listen binds the TCP socket for addr on network, one of tcp, tcp4 or tcp6,
+// with SO_REUSEPORT set if reusePort is true. Permission errors, typically
+// caused by binding a privileged port as a non-root user, get an actionable
+// message.
+func listen(network, addr string, reusePort bool) (net.Listener, error) {
+	var lc net.ListenConfig
+	if reusePort {
+		lc.Control = reusePortControl
+	}
+	ln, err := lc.Listen(context.Background(), network, addr)
+	if err != nil {
+		return nil, explainListenError(err)
+	}
+	return ln, nil
 }
 
-func hashRandomData(bytesToProcess int) string {
-	buffer := make([]byte, 1024) // 1KB buffer
-	hasher := sha256.New()
+// explainListenError adds a hint on how to fix err when it is the permission
+// error of binding a privileged port.
+func explainListenError(err error) error {
+	if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("%w: ports below 1024 usually require root or the CAP_NET_BIND_SERVICE capability; run with those privileges or bind an unprivileged port such as :8080", err)
+	}
+	return err
+}
 
-	bytesProcessed := 0
-	h := []byte{}
-	for bytesProcessed < bytesToProcess {
-		rand.Read(buffer) // Fill buffer with random data
-		hasher.Write(buffer)
-		h = hasher.Sum(nil)
-		bytesProcessed += len(buffer)
+// listenFamily describes which address families a listener bound on network
+// accepts connections from. With plain tcp, an unspecified address such as
+// :8080, [::]:8080 or even 0.0.0.0:8080 gets a dual-stack IPv6 socket
+// wherever the system supports it, shown by addr being reported as [::].
+func listenFamily(network string, addr net.Addr) string {
+	switch network {
+	case "tcp4":
+		return "IPv4"
+	case "tcp6":
+		return "IPv6"
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	switch {
+	case !ok:
+		return addr.Network()
+	case tcpAddr.IP.To4() != nil:
+		return "IPv4"
+	case tcpAddr.IP.IsUnspecified():
+		return "IPv4 and IPv6"
+	default:
+		return "IPv6"
 	}
+}
+
+// altSvcHandler advertises the HTTP/3 server on responses served over TCP so
+// that clients can upgrade to QUIC on subsequent requests.
+func altSvcHandler(h3srv *http3.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h3srv.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
 
-	return fmt.Sprintf("%x", h)
+// updateOpenFDs refreshes the openFDs gauge every interval until ctx is done,
+// so descriptor leaks in the long-running handlers show up between scrapes.
+func updateOpenFDs(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := countOpenFDs()
+		if err == nil {
+			openFDs.Set(float64(n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
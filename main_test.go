@@ -0,0 +1,373 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newTestRegistry registers every metric the app can expose, including the
+// ones main only registers when their flag is set. Each vector gets one child
+// so that it shows up in Gather, removed again when the test ends.
+func newTestRegistry(t *testing.T) *prometheus.Registry {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	collectors := []prometheus.Collector{
+		version, goInfo, goGoroutines, openFDs, metricsGatherDuration,
+		httpRequestsTotal, httpRequestDuration, newResponseSizeHistogram(prometheus.DefBuckets), httpSizeRatio,
+		httpRequestsInFlight, http2ActiveStreams, tlsHandshakeDuration, httpConnections, httpConnectionStatesTotal,
+		httpRequestsByAgentTotal, httpRequestsShedTotal, httpRequestsTimedOutTotal, httpRequestsRate,
+		httpRequestsSLOTotal, httpRequestsSLOViolationsTotal,
+		httpRequestsMemstatsSampledTotal, httpRequestsWithGCTotal, httpRequestGCPauseSecondsTotal,
+		httpClientRequestsTotal, httpClientRequestDuration, httpClientRequestsInFlight, httpClientDisconnectsTotal,
+		longPollWaiters, sseConnections, dnsLookupDuration, waitDuration, waitRequested,
+		memorySpikeBytes, memoryPressure, memoryPressureRejectionsTotal, leakedGoroutinesTotal,
+		workerPoolQueueDepth, workerPoolActive, goroutinesPeak, schedulerJitter, hashAllocBytes,
+		ordersTotal, orderValueDollars, demoSine, dbPoolInUse, dbPoolWaiters, dbQueryDuration,
+		fakeTargets{n: 1},
+	}
+	collectors = append(collectors, configGauges([]configValue{
+		{"request_timeout_seconds", "request-timeout", 0},
+		{"max_header_bytes", "max-header-bytes", 0},
+		{"load_max_mem_bytes", "load-max-mem-mb", 0},
+		{"response_size_buckets", "response-size-buckets", 0},
+	})...)
+	for _, c := range collectors {
+		registry.MustRegister(c)
+		var vec *prometheus.MetricVec
+		switch v := c.(type) {
+		case *prometheus.CounterVec:
+			vec = v.MetricVec
+		case *prometheus.GaugeVec:
+			vec = v.MetricVec
+		case *prometheus.HistogramVec:
+			vec = v.MetricVec
+		default:
+			continue
+		}
+		// The number of labels is not exported, so try until the count
+		// matches.
+		for n := 1; ; n++ {
+			lvs := slices.Repeat([]string{"x"}, n)
+			if _, err := vec.GetMetricWithLabelValues(lvs...); err == nil {
+				t.Cleanup(func() { vec.DeleteLabelValues(lvs...) })
+				break
+			}
+			if n > 10 {
+				t.Fatalf("could not create a child of %v", c)
+			}
+		}
+	}
+	return registry
+}
+
+// unitWords name quantities that must carry a base unit suffix.
+var unitWords = map[string]string{
+	"duration": "seconds",
+	"latency":  "seconds",
+	"jitter":   "seconds",
+	"pause":    "seconds",
+	"alloc":    "bytes",
+	"mem":      "bytes",
+}
+
+func TestMetricNames(t *testing.T) {
+	mfs, err := newTestRegistry(t).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) < 50 {
+		t.Fatalf("gathered only %d metric families", len(mfs))
+	}
+	for _, mf := range mfs {
+		name := mf.GetName()
+		if mf.GetHelp() == "" {
+			t.Errorf("%s has no help text", name)
+		}
+		base, isTotal := strings.CutSuffix(name, "_total")
+		if counter := mf.GetType() == dto.MetricType_COUNTER; counter != isTotal {
+			t.Errorf("%s is a %s, only counters end in _total", name, mf.GetType())
+		}
+		words := strings.Split(base, "_")
+		for i, word := range words {
+			if (word == "seconds" || word == "bytes") && i != len(words)-1 {
+				t.Errorf("%s has the unit %s in the middle of its name", name, word)
+			}
+			if unit, ok := unitWords[word]; ok && words[len(words)-1] != unit {
+				t.Errorf("%s measures %s and must end in _%s", name, word, unit)
+			}
+		}
+	}
+}
+
+// writeTestCert writes a self-signed certificate for localhost and 127.0.0.1
+// with the given common name, and its key, to dir.
+func writeTestCert(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestHTTP3(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "localhost")
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP is unavailable: %v", err)
+	}
+	h3srv := &http3.Server{
+		Handler:   newFoundHandler("hello", "text/plain"),
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{GetCertificate: certs.GetCertificate}),
+	}
+	go h3srv.Serve(conn)
+	defer h3srv.Close()
+
+	tr := &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer tr.Close()
+	resp, err := (&http.Client{Transport: tr, Timeout: 5 * time.Second}).Get("https://" + conn.LocalAddr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.Proto != "HTTP/3.0" || string(body) != "hello" {
+		t.Errorf("got %s %q, want HTTP/3.0 \"hello\"", resp.Proto, body)
+	}
+
+	rec := httptest.NewRecorder()
+	altSvcHandler(h3srv, newFoundHandler("hello", "text/plain")).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	if got, want := rec.Header().Get("Alt-Svc"), fmt.Sprintf(`h3=":%d"`, port); !strings.Contains(got, want) {
+		t.Errorf("Alt-Svc = %q, want it to contain %s", got, want)
+	}
+}
+
+func TestListenErrors(t *testing.T) {
+	denied := &net.OpError{Op: "listen", Net: "tcp", Err: os.NewSyscallError("bind", syscall.EACCES)}
+	if err := explainListenError(denied); !errors.Is(err, os.ErrPermission) || !strings.Contains(err.Error(), "CAP_NET_BIND_SERVICE") {
+		t.Errorf("explainListenError(%v) = %v, want the privileged port hint", denied, err)
+	}
+
+	ln, err := listen("tcp", "127.0.0.1:0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if _, err := listen("tcp", ln.Addr().String(), false); err == nil || strings.Contains(err.Error(), "CAP_NET_BIND_SERVICE") {
+		t.Errorf("binding a port in use: got %v, want an error without the privileged port hint", err)
+	}
+}
+
+// startServer starts the server newServer builds for cfg on a local port,
+// serving a plain greeting.
+func startServer(t *testing.T, cfg serverConfig) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(nil)
+	ts.Config = newServer("", newFoundHandler("hello", "text/plain"), nil, newConnTracker(), cfg)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestDisableKeepAlives(t *testing.T) {
+	for _, disable := range []bool{false, true} {
+		ts := startServer(t, serverConfig{maxHeaderBytes: http.DefaultMaxHeaderBytes, disableKeepAlives: disable})
+		resp, err := ts.Client().Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.Close != disable {
+			t.Errorf("-disable-keepalives=%t: Connection: close sent = %t", disable, resp.Close)
+		}
+	}
+}
+
+func TestFoundHandler(t *testing.T) {
+	for _, tc := range []struct {
+		contentType, body string
+	}{
+		{"text/plain; charset=utf-8", "hello"},
+		{"application/json", `{"message":"hello"}`},
+	} {
+		rec := httptest.NewRecorder()
+		newFoundHandler("hello", tc.contentType).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := rec.Header().Get("Content-Type"); got != tc.contentType {
+			t.Errorf("Content-Type = %q, want %q", got, tc.contentType)
+		}
+		if got := rec.Body.String(); got != tc.body {
+			t.Errorf("%s body = %q, want %q", tc.contentType, got, tc.body)
+		}
+	}
+}
+
+func TestGoInfo(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(goInfo)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || mfs[0].GetName() != "go_info" {
+		t.Fatalf("gathered %v, want go_info", mfs)
+	}
+	labels := mfs[0].GetMetric()[0].GetLabel()
+	if len(labels) != 1 || labels[0].GetName() != "version" || labels[0].GetValue() != runtime.Version() {
+		t.Errorf("go_info has labels %v, want version=%q", labels, runtime.Version())
+	}
+}
+
+func TestStaticHandler(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello from disk"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/static/", newStaticHandler("/static/", dir))
+	rec := serve(mux, http.MethodGet, "/static/hello.txt")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello from disk" {
+		t.Errorf("got %d %q, want the file contents", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/plain; charset=utf-8", ct)
+	}
+	if rec := serve(mux, http.MethodGet, "/static/missing.txt"); rec.Code != http.StatusNotFound {
+		t.Errorf("a missing file: got %d, want 404", rec.Code)
+	}
+}
+
+func TestMaxHeaderBytes(t *testing.T) {
+	ts := startServer(t, serverConfig{maxHeaderBytes: 1024})
+	for size, want := range map[int]int{100: http.StatusOK, 16 * 1024: http.StatusRequestHeaderFieldsTooLarge} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		req.Header.Set("X-Padding", strings.Repeat("a", size))
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("a %d byte header: got %d, want %d", size, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestMultipleBindAddresses(t *testing.T) {
+	addrs := splitList("127.0.0.1:0, 127.0.0.1:0")
+	if len(addrs) != 2 {
+		t.Fatalf("split -bind into %q, want two addresses", addrs)
+	}
+	handler := newFoundHandler("hello", "text/plain")
+	for _, addr := range addrs {
+		ln, err := listen("tcp", addr, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := &http.Server{Handler: handler}
+		go srv.Serve(ln)
+		defer srv.Close()
+		resp, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s answered %d", ln.Addr(), resp.StatusCode)
+		}
+	}
+}
+
+func TestBindNetwork(t *testing.T) {
+	for _, tc := range []struct {
+		network, family, reachable, unreachable string
+	}{
+		{"tcp4", "IPv4", "127.0.0.1", "::1"},
+		{"tcp6", "IPv6", "::1", "127.0.0.1"},
+	} {
+		ln, err := listen(tc.network, ":0", false)
+		if err != nil {
+			t.Logf("skipping %s, the family is unavailable: %v", tc.network, err)
+			continue
+		}
+		defer ln.Close()
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+		if family := listenFamily(tc.network, ln.Addr()); family != tc.family {
+			t.Errorf("%s: listening on %s, want %s", tc.network, family, tc.family)
+		}
+		port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(tc.reachable, port), time.Second)
+		if err != nil {
+			t.Errorf("%s: connecting over %s: %v", tc.network, tc.reachable, err)
+		} else {
+			conn.Close()
+		}
+		if conn, err := net.DialTimeout("tcp", net.JoinHostPort(tc.unreachable, port), time.Second); err == nil {
+			conn.Close()
+			t.Errorf("%s: connected over %s, want only %s", tc.network, tc.unreachable, tc.family)
+		}
+	}
+	if got := listenFamily("tcp", &net.TCPAddr{IP: net.IPv6unspecified}); got != "IPv4 and IPv6" {
+		t.Errorf("a tcp listener on [::] accepts %s, want both families", got)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+// maintenanceExempt are the handlers that keep answering in maintenance mode,
+// so that orchestrators can still tell the instance is alive and not ready.
+var maintenanceExempt = map[string]bool{
+	"startupz": true,
+	"healthz":  true,
+	"readyz":   true,
+}
+
+// maintenanceMode quiesces an instance without stopping it: while it is on,
+// every instrumented handler except the probes answers 503. /metrics and
+// the admin endpoints are not instrumented and keep working.
+type maintenanceMode struct {
+	on atomic.Bool
+}
+
+// maintenanceSettings is the body of GET and POST /admin/maintenance.
+type maintenanceSettings struct {
+	Enabled bool `json:"enabled"`
+}
+
+// wrap answers requests to the handler registered as name with 503 while
+// maintenance mode is on.
+func (m *maintenanceMode) wrap(name string, h http.Handler) http.Handler {
+	if m == nil || maintenanceExempt[name] {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.on.Load() {
+			w.Header().Set("Retry-After", "60")
+			writeError(w, apiError{Code: http.StatusServiceUnavailable, Message: "down for maintenance"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// adminHandler serves /admin/maintenance: GET returns whether maintenance
+// mode is on and POST switches it.
+func (m *maintenanceMode) adminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var s maintenanceSettings
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&s); err != nil {
+				writeError(w, apiError{Code: http.StatusBadRequest, Message: "invalid maintenance settings: " + err.Error()})
+				return
+			}
+			if m.on.Swap(s.Enabled) != s.Enabled {
+				log.Printf("maintenance mode enabled: %t", s.Enabled)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(maintenanceSettings{Enabled: m.on.Load()})
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	m := &maintenanceMode{}
+	p := &probes{maintenance: m}
+	p.started.Store(true)
+	p.heartbeat.Store(time.Now().UnixNano())
+	inst := newTestInstrumenter()
+	inst.maintenance = m
+	mux := http.NewServeMux()
+	mux.Handle("/{$}", inst.instrument("found", newFoundHandler("hello", "text/plain")))
+	mux.Handle("/healthz", inst.instrument("healthz", p.livenessHandler()))
+	mux.Handle("/readyz", inst.instrument("readyz", p.readinessHandler()))
+	mux.Handle("POST /admin/maintenance", m.adminHandler())
+
+	toggle := func(body string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/maintenance", strings.NewReader(body)))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), body) {
+			t.Fatalf("POST %s: got %d %q", body, rec.Code, rec.Body)
+		}
+	}
+	check := func(stage string, codes map[string]int) {
+		t.Helper()
+		for target, want := range codes {
+			if rec := serve(mux, http.MethodGet, target); rec.Code != want {
+				t.Errorf("%s: %s answered %d, want %d", stage, target, rec.Code, want)
+			}
+		}
+	}
+
+	toggle(`{"enabled":true}`)
+	check("in maintenance", map[string]int{"/": http.StatusServiceUnavailable, "/healthz": http.StatusOK, "/readyz": http.StatusServiceUnavailable})
+	if rec := serve(mux, http.MethodGet, "/"); rec.Header().Get("Retry-After") == "" {
+		t.Error("in maintenance: / has no Retry-After")
+	}
+	toggle(`{"enabled":false}`)
+	check("after maintenance", map[string]int{"/": http.StatusOK, "/healthz": http.StatusOK, "/readyz": http.StatusOK})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// memoryGuard rejects memory-hungry requests while the heap is above a high
+// watermark, and lets them through again once it has dropped below a low
+// one. The gap between the two keeps it from flapping around a single limit.
+type memoryGuard struct {
+	high, low uint64
+	// heapBytes reports the current heap size. It is a field so that the
+	// source of the figure can be swapped.
+	heapBytes func() uint64
+	pressure  atomic.Bool
+}
+
+// newMemoryGuard returns a guard with watermarks in megabytes. A low
+// watermark of 0 defaults to 80% of the high one. A high watermark of 0
+// disables the guard and returns nil.
+func newMemoryGuard(highMB, lowMB int) *memoryGuard {
+	if highMB <= 0 {
+		return nil
+	}
+	high := uint64(highMB) * 1024 * 1024
+	low := uint64(lowMB) * 1024 * 1024
+	if lowMB <= 0 {
+		low = high / 10 * 8
+	}
+	return &memoryGuard{high: high, low: low, heapBytes: heapAllocBytes}
+}
+
+func heapAllocBytes() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
+
+// watch checks the heap every interval until ctx is done.
+func (g *memoryGuard) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		g.check()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *memoryGuard) check() {
+	if g.pressure.Load() {
+		// An idle process may not collect for a long time, and the heap
+		// figure only shrinks after a collection, so force one rather
+		// than rejecting requests indefinitely.
+		runtime.GC()
+	}
+	heap := g.heapBytes()
+	switch {
+	case !g.pressure.Load() && heap >= g.high:
+		g.pressure.Store(true)
+		memoryPressure.Set(1)
+		log.Printf("heap at %d MB is above the high watermark, rejecting memory-hungry requests", heap/1024/1024)
+	case g.pressure.Load() && heap < g.low:
+		g.pressure.Store(false)
+		memoryPressure.Set(0)
+		log.Printf("heap at %d MB is below the low watermark, accepting memory-hungry requests again", heap/1024/1024)
+	}
+}
+
+// protect rejects requests to next with 503 while the heap is under pressure.
+// A nil guard lets every request through.
+func (g *memoryGuard) protect(handler string, next http.Handler) http.Handler {
+	if g == nil {
+		return next
+	}
+	rejected := memoryPressureRejectionsTotal.WithLabelValues(handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g.pressure.Load() {
+			rejected.Inc()
+			w.Header().Set("Retry-After", "5")
+			writeError(w, apiError{
+				Code:    http.StatusServiceUnavailable,
+				Message: "memory is running low, try again later",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
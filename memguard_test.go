@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMemoryGuard(t *testing.T) {
+	g := newMemoryGuard(100, 50)
+	var heap uint64
+	g.heapBytes = func() uint64 { return heap }
+	mux := http.NewServeMux()
+	mux.Handle("/hash", g.protect("hash", newFoundHandler("hashed", "text/plain")))
+	mux.Handle("/", newFoundHandler("hello", "text/plain"))
+	rejected := memoryPressureRejectionsTotal.WithLabelValues("hash")
+
+	for _, tc := range []struct {
+		heapMB   uint64
+		hashCode int
+	}{
+		{10, http.StatusOK},
+		{100, http.StatusServiceUnavailable}, // at the high watermark
+		{70, http.StatusServiceUnavailable},  // still above the low one
+		{49, http.StatusOK},
+		{70, http.StatusOK}, // between the two, pressure has not come back
+	} {
+		heap = tc.heapMB * 1024 * 1024
+		g.check()
+		before := testutil.ToFloat64(rejected)
+		if rec := serve(mux, http.MethodGet, "/hash"); rec.Code != tc.hashCode {
+			t.Errorf("heap at %d MB: /hash answered %d, want %d", tc.heapMB, rec.Code, tc.hashCode)
+		}
+		if rec := serve(mux, http.MethodGet, "/"); rec.Code != http.StatusOK {
+			t.Errorf("heap at %d MB: / answered %d, want 200", tc.heapMB, rec.Code)
+		}
+		want := 0.0
+		if tc.hashCode == http.StatusServiceUnavailable {
+			want = 1
+		}
+		if got := testutil.ToFloat64(rejected) - before; got != want {
+			t.Errorf("heap at %d MB: memory_pressure_rejections_total increased by %v, want %v", tc.heapMB, got, want)
+		}
+	}
+}
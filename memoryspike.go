@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// newMemorySpikeHandler returns the handler for /memory-spike/{mb}/{holdms},
+// which allocates mb megabytes, holds them for holdms milliseconds and then
+// releases them, tracking the amount held in memory_spike_bytes so that the
+// spike shows up as a clean rise and fall. It releases the memory early if the
+// client goes away, and forces a garbage collection afterwards so the heap
+// metrics fall back right away too. The mb and holdms are bounded by
+// -load-max-mem-mb and -load-max-sleep.
+func newMemorySpikeHandler(limits loadLimits) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mb, err := strconv.Atoi(r.PathValue("mb"))
+		if err != nil || mb < 0 || mb > limits.maxMemMB {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("mb must be an integer between 0 and %d", limits.maxMemMB)})
+			return
+		}
+		holdMs, err := strconv.Atoi(r.PathValue("holdms"))
+		if err != nil || holdMs < 0 || holdMs > int(limits.maxSleep.Milliseconds()) {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("holdms must be an integer between 0 and %d", limits.maxSleep.Milliseconds())})
+			return
+		}
+
+		start := time.Now()
+		size := float64(mb) * 1024 * 1024
+		mem := allocate(mb)
+		memorySpikeBytes.Add(size)
+		err = sleepContext(r.Context(), time.Duration(holdMs)*time.Millisecond)
+		runtime.KeepAlive(mem)
+		mem = nil
+		memorySpikeBytes.Sub(size)
+		runtime.GC()
+		if err != nil {
+			return // the client went away, nobody is left to answer
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			MB             int     `json:"mb"`
+			HoldMillis     int     `json:"hold_ms"`
+			ElapsedSeconds float64 `json:"elapsed_seconds"`
+		}{mb, holdMs, time.Since(start).Seconds()})
+	})
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMemorySpike(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/memory-spike/{mb}/{holdms}", newMemorySpikeHandler(loadLimits{maxMemMB: 16, maxSleep: time.Second}))
+	before := testutil.ToFloat64(memorySpikeBytes)
+
+	done := make(chan int)
+	go func() { done <- serve(mux, http.MethodGet, "/memory-spike/4/200").Code }()
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(memorySpikeBytes)-before != 4*1024*1024 {
+		if time.Now().After(deadline) {
+			t.Fatal("memory_spike_bytes did not rise to the 4 MB held")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("got %d, want 200", code)
+	}
+	if got := testutil.ToFloat64(memorySpikeBytes) - before; got != 0 {
+		t.Errorf("memory_spike_bytes is %v above where it started after the release", got)
+	}
+	if rec := serve(mux, http.MethodGet, "/memory-spike/17/0"); rec.Code != http.StatusBadRequest {
+		t.Errorf("above -load-max-mem-mb: got %d, want 400", rec.Code)
+	}
+}
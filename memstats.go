@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// gcAttribution samples requests and reads runtime.MemStats around them to
+// find out whether a garbage collection ran while they were served, which
+// explains many of the outliers in the latency histogram. ReadMemStats
+// stops the world, so only 1 in rate requests is sampled.
+type gcAttribution struct {
+	rate int
+}
+
+// wrap samples requests to the handler registered as name. A nil
+// gcAttribution samples nothing.
+func (g *gcAttribution) wrap(name string, h http.Handler) http.Handler {
+	if g == nil {
+		return h
+	}
+	sampled := httpRequestsMemstatsSampledTotal.WithLabelValues(name)
+	withGC := httpRequestsWithGCTotal.WithLabelValues(name)
+	paused := httpRequestGCPauseSecondsTotal.WithLabelValues(name)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g.rate > 1 && rand.IntN(g.rate) != 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		h.ServeHTTP(w, r)
+		runtime.ReadMemStats(&after)
+
+		sampled.Inc()
+		gcs := after.NumGC - before.NumGC
+		if gcs == 0 {
+			return
+		}
+		pause := time.Duration(after.PauseTotalNs - before.PauseTotalNs)
+		withGC.Inc()
+		paused.Add(pause.Seconds())
+		log.Printf("%d GC cycles ran during %s %s, pausing for %s in total", gcs, r.Method, r.URL.Path, pause)
+	})
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGCAttribution(t *testing.T) {
+	buf := captureLog(t)
+	g := &gcAttribution{rate: 1}
+	h := g.wrap("gc", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		runtime.GC()
+	}))
+	sampled, withGC, paused := httpRequestsMemstatsSampledTotal.WithLabelValues("gc"), httpRequestsWithGCTotal.WithLabelValues("gc"), httpRequestGCPauseSecondsTotal.WithLabelValues("gc")
+	sampledBefore, withGCBefore, pausedBefore := testutil.ToFloat64(sampled), testutil.ToFloat64(withGC), testutil.ToFloat64(paused)
+
+	serve(h, http.MethodGet, "/gc")
+	if got := testutil.ToFloat64(sampled) - sampledBefore; got != 1 {
+		t.Errorf("http_requests_memstats_sampled_total increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(withGC) - withGCBefore; got != 1 {
+		t.Errorf("http_requests_with_gc_total increased by %v, want 1 for a request that collected", got)
+	}
+	if got := testutil.ToFloat64(paused) - pausedBefore; got <= 0 {
+		t.Errorf("http_request_gc_pause_seconds_total increased by %v, want the pause of the collection", got)
+	}
+	if !strings.Contains(buf.String(), "GC cycles ran during GET /gc") {
+		t.Errorf("log %q does not attribute the collection to the request", buf)
+	}
+}
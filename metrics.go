@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// newMetricsHandler serves the metrics gathered from g. Scrapes asking for
+// ?timestamps=true get every sample stamped with the time of the gather, for
+// ingestion pipelines that want explicit timestamps. That is off by default
+// because Prometheus handles staleness differently for samples carrying
+// explicit timestamps.
+func newMetricsHandler(g prometheus.Gatherer, opts promhttp.HandlerOpts) http.Handler {
+	plain := promhttp.HandlerFor(g, opts)
+	stamped := promhttp.HandlerFor(timestampedGatherer(g), opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, _ := strconv.ParseBool(r.URL.Query().Get("timestamps")); ok {
+			stamped.ServeHTTP(w, r)
+			return
+		}
+		plain.ServeHTTP(w, r)
+	})
+}
+
+// newScrapeHandler returns the handler for /metrics, serving the metrics
+// gathered from g and timing every gather in metrics_gather_duration_seconds.
+// With etag set, responses carry an ETag that ignores that timing, see
+// withETag.
+func newScrapeHandler(g prometheus.Gatherer, noCompression, etag bool) http.Handler {
+	opts := promhttp.HandlerOpts{
+		DisableCompression: noCompression,
+		// Without this, scrapers asking for OpenMetrics silently get the
+		// classic text format instead.
+		EnableOpenMetrics: true,
+	}
+	if !etag {
+		return newMetricsHandler(timedGatherer(g), opts)
+	}
+	return withETag(timedGatherer(g), []string{"metrics_gather_duration_seconds"}, func(g prometheus.Gatherer) http.Handler {
+		return newMetricsHandler(g, opts)
+	})
+}
+
+// metricMetadata describes one metric family in the /metadata response.
+type metricMetadata struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Help string `json:"help"`
+}
+
+// newMetadataHandler serves the name, type and help of every metric family
+// gathered from g as JSON, without any samples, for tooling that wants to
+// know which metrics exist.
+func newMetadataHandler(g prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mfs, err := g.Gather()
+		if err != nil && len(mfs) == 0 {
+			writeError(w, apiError{Code: http.StatusInternalServerError, Message: "failed to gather metrics: " + err.Error()})
+			return
+		}
+		metadata := make([]metricMetadata, 0, len(mfs))
+		for _, mf := range mfs {
+			metadata = append(metadata, metricMetadata{Name: mf.GetName(), Type: mf.GetType().String(), Help: mf.GetHelp()})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Metrics []metricMetadata `json:"metrics"`
+		}{metadata})
+	})
+}
+
+// timedGatherer records how long each Gather of g takes. The value exposed in
+// a scrape is therefore the duration of the previous scrape's gather.
+func timedGatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		start := time.Now()
+		mfs, err := g.Gather()
+		metricsGatherDuration.Set(time.Since(start).Seconds())
+		return mfs, err
+	})
+}
+
+// timestampedGatherer sets the time of the gather as the timestamp of every
+// sample gathered from g.
+func timestampedGatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		ts := time.Now().UnixMilli()
+		for _, mf := range mfs {
+			for _, m := range mf.Metric {
+				m.TimestampMs = &ts
+			}
+		}
+		return mfs, err
+	})
+}
+
+// delayMetrics answers 503 instead of serving next until delay has passed
+// since start, simulating an app whose metrics are not ready right away.
+func delayMetrics(start time.Time, delay time.Duration, next http.Handler) http.Handler {
+	if delay <= 0 {
+		return next
+	}
+	ready := start.Add(delay)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait := time.Until(ready); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, apiError{Code: http.StatusServiceUnavailable, Message: "metrics are not ready yet"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// targetLabels returns the labels added to every metric: job and instance
+// when job is set, and deployment when it is set.
+func targetLabels(job, instance, deployment string) prometheus.Labels {
+	labels := prometheus.Labels{}
+	if job != "" {
+		// Prometheus renames these to exported_job and exported_instance
+		// when it scrapes them, unless the scrape job sets honor_labels.
+		labels["job"] = job
+		labels["instance"] = instance
+	}
+	if deployment != "" {
+		labels["deployment"] = deployment
+	}
+	return labels
+}
+
+// dumpMetrics writes everything gathered from g in the text exposition format
+// to path, or to stdout if path is "-".
+func dumpMetrics(g prometheus.Gatherer, path string) error {
+	mfs, err := g.Gather()
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(&b, mf); err != nil {
+			return err
+		}
+	}
+	if path == "-" {
+		_, err = os.Stdout.Write(b.Bytes())
+		return err
+	}
+	return os.WriteFile(path, b.Bytes(), 0o644)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// scrape serves a GET of target from h and returns the recorded response.
+func scrape(h http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTimedGatherer(t *testing.T) {
+	metricsGatherDuration.Set(0)
+	// A gatherer slow enough that the duration cannot round to zero.
+	slow := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		time.Sleep(time.Millisecond)
+		return nil, nil
+	})
+	rec := scrape(newMetricsHandler(timedGatherer(slow), promhttp.HandlerOpts{}), "/metrics", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scrape answered %d", rec.Code)
+	}
+	if d := testutil.ToFloat64(metricsGatherDuration); d <= 0 {
+		t.Errorf("metrics_gather_duration_seconds = %v after a scrape, want a positive value", d)
+	}
+}
+
+func TestMetricsCompression(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(version)
+	for _, disable := range []bool{false, true} {
+		h := newMetricsHandler(registry, promhttp.HandlerOpts{DisableCompression: disable})
+		rec := scrape(h, "/metrics", http.Header{"Accept-Encoding": {"gzip"}})
+		gzipped := rec.Header().Get("Content-Encoding") == "gzip"
+		if gzipped == disable {
+			t.Errorf("-metrics-no-compression=%t: Content-Encoding = %q", disable, rec.Header().Get("Content-Encoding"))
+		}
+	}
+}
+
+func TestMetricsTimestamps(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(version)
+	h := newMetricsHandler(registry, promhttp.HandlerOpts{})
+	for target, want := range map[string]bool{"/metrics": false, "/metrics?timestamps=true": true} {
+		var sample string
+		for _, line := range strings.Split(scrape(h, target, nil).Body.String(), "\n") {
+			if strings.HasPrefix(line, "version{") {
+				sample = line
+			}
+		}
+		// A sample line is the series, the value and an optional timestamp.
+		if fields := strings.Fields(sample); (len(fields) == 3) != want {
+			t.Errorf("%s: sample %q, want a timestamp: %t", target, sample, want)
+		}
+	}
+}
+
+func TestMetricsReadyDelay(t *testing.T) {
+	h := delayMetrics(time.Now(), 50*time.Millisecond, newFoundHandler("metrics", "text/plain"))
+	rec := serve(h, http.MethodGet, "/metrics")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("before the delay: got %d with Retry-After %q, want 503 and 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	time.Sleep(60 * time.Millisecond)
+	if rec := serve(h, http.MethodGet, "/metrics"); rec.Code != http.StatusOK {
+		t.Errorf("after the delay: got %d, want 200", rec.Code)
+	}
+}
+
+func TestMetricsContentNegotiation(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(version)
+	h := newMetricsHandler(registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+	const (
+		text        = "text/plain; version=0.0.4"
+		protobuf    = "application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited"
+		openMetrics = "application/openmetrics-text; version=1.0.0"
+	)
+	for _, tc := range []struct {
+		accept, want string
+	}{
+		{"", text},
+		{"*/*", text},
+		{"text/plain", text},
+		{"text/plain;version=0.0.4", text},
+		{"application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited", protobuf},
+		{"application/openmetrics-text;version=1.0.0", openMetrics},
+		{"application/openmetrics-text;version=0.0.1", "application/openmetrics-text; version=0.0.1"},
+		// What Prometheus 2.x sends by default.
+		{"application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1", openMetrics},
+		// What Prometheus sends with native histograms enabled.
+		{"application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited,application/openmetrics-text;version=1.0.0;q=0.8,text/plain;version=0.0.4;q=0.2,*/*;q=0.1", protobuf},
+	} {
+		var header http.Header
+		if tc.accept != "" {
+			header = http.Header{"Accept": {tc.accept}}
+		}
+		rec := scrape(h, "/metrics", header)
+		if ct := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || !strings.HasPrefix(ct, tc.want) {
+			t.Errorf("Accept %q: got %d with Content-Type %q, want %q", tc.accept, rec.Code, ct, tc.want)
+		}
+	}
+}
+
+func TestDumpMetricsOnExit(t *testing.T) {
+	registry := newTestRegistry(t)
+	inst := newTestInstrumenter()
+	ts := httptest.NewServer(inst.instrument("found", newFoundHandler("hello", "text/plain")))
+	resp, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := ts.Config.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ts.Close()
+
+	path := filepath.Join(t.TempDir(), "metrics.txt")
+	if err := dumpMetrics(registry, path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `http_requests_total{code="200",method="get",proto="HTTP/1.1",route_matched="true"}`; !strings.Contains(string(b), want) {
+		t.Errorf("dump does not contain %s:\n%s", want, b)
+	}
+}
+
+func TestTargetLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	prometheus.WrapRegistererWith(targetLabels("example", "pod-1", ""), reg).MustRegister(version)
+	body := scrape(newMetricsHandler(reg, promhttp.HandlerOpts{}), "/metrics", nil).Body.String()
+	if want := `version{instance="pod-1",job="example",version="` + appVersion + `"}`; !strings.Contains(body, want) {
+		t.Errorf("scrape does not contain %s:\n%s", want, body)
+	}
+
+	if labels := targetLabels("", "pod-1", ""); len(labels) != 0 {
+		t.Errorf("without -job-name got labels %v, want none", labels)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	registry := newTestRegistry(t)
+	httpRequestsTotal.WithLabelValues("200", "get", "HTTP/1.1", "true")
+	var body struct {
+		Metrics []metricMetadata `json:"metrics"`
+	}
+	if err := json.Unmarshal(scrape(newMetadataHandler(registry), "/metadata", nil).Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := metricMetadata{Name: "http_requests_total", Type: "COUNTER", Help: "Count of all HTTP requests"}
+	if !slices.Contains(body.Metrics, want) {
+		t.Errorf("metadata %+v does not contain %+v", body.Metrics, want)
+	}
+}
+
+func TestDeploymentLabel(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	prometheus.WrapRegistererWith(targetLabels("", "", "canary"), reg).MustRegister(httpRequestsTotal)
+	inst := newTestInstrumenter()
+	serve(inst.instrument("found", newFoundHandler("hello", "text/plain")), http.MethodGet, "/")
+
+	body := scrape(newMetricsHandler(reg, promhttp.HandlerOpts{}), "/metrics", nil).Body.String()
+	if want := `http_requests_total{code="200",deployment="canary",method="get",proto="HTTP/1.1",route_matched="true"}`; !strings.Contains(body, want) {
+		t.Errorf("scrape does not contain %s:\n%s", want, body)
+	}
+}
+
+func TestMetricsAll(t *testing.T) {
+	registry, internalRegistry := prometheus.NewRegistry(), prometheus.NewRegistry()
+	registry.MustRegister(version)
+	internalRegistry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	for _, tc := range []struct {
+		g             prometheus.Gatherer
+		app, internal bool
+	}{
+		{registry, true, false},
+		{internalRegistry, false, true},
+		{prometheus.Gatherers{registry, internalRegistry}, true, true},
+	} {
+		body := scrape(promhttp.HandlerFor(tc.g, promhttp.HandlerOpts{}), "/metrics/all", nil).Body.String()
+		if app := strings.Contains(body, "# TYPE version gauge"); app != tc.app {
+			t.Errorf("app metrics exposed: %t, want %t", app, tc.app)
+		}
+		if internal := strings.Contains(body, "# TYPE process_start_time_seconds gauge"); internal != tc.internal {
+			t.Errorf("process metrics exposed: %t, want %t", internal, tc.internal)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// optionsMethods are the methods that OPTIONS responses consider listing in
+// their Allow header.
+var optionsMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// handleOptions answers OPTIONS requests for paths served by a route of mux
+// with 204 and an Allow header listing the methods that route accepts,
+// instead of running its handler. OPTIONS requests for paths served by no
+// route get the usual 404, and all other requests go to mux unchanged.
+// CORS headers for preflight requests can be added with -response-headers.
+func handleOptions(mux router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		var allowed []string
+		for _, method := range optionsMethods {
+			if mux.allows(r, method) {
+				allowed = append(allowed, method)
+			}
+		}
+		if len(allowed) == 0 {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(append(allowed, http.MethodOptions), ", "))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHandleOptions(t *testing.T) {
+	mux := newRouter()
+	mux.Handle("/", unmatchedRoute)
+	for _, p := range hashPatterns {
+		mux.Handle(p, newFoundHandler("hashed", "text/plain"))
+	}
+	mux.Handle("POST /replay", newFoundHandler("replayed", "text/plain"))
+	h := handleOptions(mux)
+
+	for _, tc := range []struct {
+		target string
+		code   int
+		allow  string
+	}{
+		{"/hash/5", http.StatusNoContent, "GET, HEAD, OPTIONS"},
+		{"/replay", http.StatusNoContent, "POST, OPTIONS"},
+		{"/no-such-path", http.StatusNotFound, ""},
+	} {
+		rec := serve(h, http.MethodOptions, tc.target)
+		if rec.Code != tc.code || rec.Header().Get("Allow") != tc.allow {
+			t.Errorf("OPTIONS %s: got %d with Allow %q, want %d with %q", tc.target, rec.Code, rec.Header().Get("Allow"), tc.code, tc.allow)
+		}
+		if tc.code == http.StatusNoContent && rec.Body.Len() != 0 {
+			t.Errorf("OPTIONS %s ran the handler, which wrote %q", tc.target, rec.Body)
+		}
+	}
+	if rec := serve(h, http.MethodGet, "/hash/5"); rec.Body.String() != "hashed" {
+		t.Errorf("GET /hash/5 was not passed through, got %d %q", rec.Code, rec.Body)
+	}
+	if rec := serve(h, http.MethodHead, "/hash/5"); rec.Code != http.StatusOK {
+		t.Errorf("HEAD /hash/5: got %d, want 200", rec.Code)
+	}
+	if rec := serve(h, http.MethodPost, "/hash/5"); rec.Body.String() == "hashed" {
+		t.Error("POST /hash/5 ran the GET-only handler")
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	otelprom "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// startOTLPMetricsExport pushes the metrics gathered from g to an OTLP/HTTP
+// endpoint every interval. The Prometheus registry stays the single source of
+// truth: the bridge reads from it, so /metrics and the OTLP push always agree.
+func startOTLPMetricsExport(ctx context.Context, endpoint string, interval time.Duration, g prometheus.Gatherer) (*sdkmetric.MeterProvider, error) {
+	exporter, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(interval),
+		sdkmetric.WithProducer(otelprom.NewMetricProducer(otelprom.WithGatherer(g))),
+	)
+	return sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)), nil
+}
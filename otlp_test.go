@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestOTLPMetricsExport(t *testing.T) {
+	received := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		select {
+		case received <- body:
+		default:
+		}
+	}))
+	defer receiver.Close()
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "otlp_test_exported_total", Help: "Exported by the test"})
+	counter.Inc()
+	registry.MustRegister(counter)
+	ctx := context.Background()
+	provider, err := startOTLPMetricsExport(ctx, receiver.URL+"/v1/metrics", time.Hour, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Shutting down pushes the metrics one last time.
+	if err := provider.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case body := <-received:
+		if !bytes.Contains(body, []byte("otlp_test_exported")) {
+			t.Errorf("the export does not contain otlp_test_exported_total")
+		}
+	default:
+		t.Fatal("nothing was exported")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// newPanicHandler returns the handler for /panic, which panics so that the
+// recovery path can be exercised.
+func newPanicHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("panic requested via /panic")
+	})
+}
+
+// recoverPanics turns a panic in the handler registered as name into a 500
+// and a log line. With in.panicDumpDir set it also writes a dump of every
+// goroutine's stack there, taken while the panicking goroutine's stack is
+// still intact. http.ErrAbortHandler is re-raised, as net/http expects.
+func (in instrumenter) recoverPanics(name string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			log.Printf("recovered panic in handler %s serving %s %s: %v", name, r.Method, r.URL.Path, p)
+			if in.panicDumpDir != "" {
+				if path, err := writePanicDump(in.panicDumpDir, r, p); err != nil {
+					log.Printf("failed to write panic dump: %v", err)
+				} else {
+					log.Printf("wrote panic dump to %s", path)
+				}
+			}
+			writeError(w, apiError{Code: http.StatusInternalServerError, Message: "internal error"})
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// writePanicDump writes the stacks of all goroutines to a timestamped file in
+// dir, headed by the request that panicked and the panic value.
+func writePanicDump(dir string, r *http.Request, p any) (string, error) {
+	now := time.Now().UTC()
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "time: %s\nrequest: %s %s\npanic: %v\n\n", now.Format(time.RFC3339Nano), r.Method, r.URL.Path, p)
+	b.Write(allStacks())
+	path := filepath.Join(dir, "panic-"+now.Format("20060102T150405.000000000Z")+".txt")
+	return path, os.WriteFile(path, b.Bytes(), 0o644)
+}
+
+// allStacks returns the stacks of all goroutines, growing the buffer until
+// it is large enough.
+func allStacks() []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPanicDump(t *testing.T) {
+	inst := newTestInstrumenter()
+	inst.panicDumpDir = t.TempDir()
+	rec := serve(inst.recoverPanics("panic", newPanicHandler()), http.MethodGet, "/panic")
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got %d, want 500", rec.Code)
+	}
+
+	dumps, err := filepath.Glob(filepath.Join(inst.panicDumpDir, "panic-*.txt"))
+	if err != nil || len(dumps) != 1 {
+		t.Fatalf("found dumps %v, want one: %v", dumps, err)
+	}
+	b, err := os.ReadFile(dumps[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := string(b)
+	for _, want := range []string{"request: GET /panic\n", "panic: panic requested via /panic\n", "goroutine ", "TestPanicDump"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("dump does not contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// newPayloadHandler returns the handler for /payload/{bytes}, which responds
+// with the requested number of random bytes, at most maxBytes, to exercise
+// egress bandwidth. The body is streamed from a single reused buffer, so the
+// payload size does not translate into memory use.
+func newPayloadHandler(maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.ParseInt(r.PathValue("bytes"), 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: "bytes must be a non-negative integer"})
+			return
+		}
+		if n > maxBytes {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("bytes must not exceed %d", maxBytes)})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+		buffer := make([]byte, 32*1024)
+		for n > 0 {
+			if r.Context().Err() != nil {
+				return
+			}
+			chunk := buffer[:min(n, int64(len(buffer)))]
+			rand.Read(chunk)
+			if _, err := w.Write(chunk); err != nil {
+				if isClientGone(err) {
+					httpClientDisconnectsTotal.WithLabelValues("payload").Inc()
+				}
+				return
+			}
+			n -= int64(len(chunk))
+		}
+	})
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestPayload(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/payload/{bytes}", newPayloadHandler(1<<20))
+	for _, n := range []int{0, 1, 32 * 1024, 100_000} {
+		rec := serve(mux, http.MethodGet, "/payload/"+strconv.Itoa(n))
+		if rec.Code != http.StatusOK || rec.Body.Len() != n {
+			t.Errorf("/payload/%d: got %d with %d bytes", n, rec.Code, rec.Body.Len())
+		}
+		if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(n) {
+			t.Errorf("/payload/%d: Content-Length = %q", n, got)
+		}
+	}
+}
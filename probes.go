@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	heartbeatInterval = time.Second
+	// heartbeatTimeout is how stale the heartbeat may get before /healthz
+	// reports the process as stuck.
+	heartbeatTimeout = 5 * heartbeatInterval
+)
+
+// probes backs the three Kubernetes probe endpoints, which deliberately
+// answer different questions: /startupz whether the app has finished
+// starting, /healthz whether the process is still scheduling goroutines and
+// should not be restarted, and /readyz whether it should receive traffic.
+type probes struct {
+	started   atomic.Bool
+	draining  atomic.Bool
+	heartbeat atomic.Int64
+	// maintenance, if set, makes /readyz fail while it is on.
+	maintenance *maintenanceMode
+
+	// failingLiveness makes /healthz fail on purpose, see failLiveness.
+	failingLiveness atomic.Bool
+	mu              sync.Mutex
+	failTimer       *time.Timer
+}
+
+// livenessFailure is the body of POST /admin/fail-liveness.
+type livenessFailure struct {
+	Fail bool `json:"fail"`
+	// DurationMillis limits how long /healthz fails. Zero means until a
+	// request with fail set to false clears it.
+	DurationMillis int64 `json:"duration_ms"`
+}
+
+// beat records a heartbeat every interval until ctx is done. If the runtime
+// stops scheduling it, for instance because every P is stuck, the heartbeat
+// goes stale and /healthz starts failing.
+func (p *probes) beat(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.heartbeat.Store(time.Now().UnixNano())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *probes) startupHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.started.Load() {
+			writeError(w, apiError{Code: http.StatusServiceUnavailable, Message: "still starting"})
+			return
+		}
+		writeResponse(w, "startupz", []byte("started\n"))
+	})
+}
+
+// failLiveness makes /healthz fail for d, or until cleared if d is zero, to
+// simulate a wedged process. Each call replaces the previous one.
+func (p *probes) failLiveness(fail bool, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failTimer != nil {
+		p.failTimer.Stop()
+		p.failTimer = nil
+	}
+	p.failingLiveness.Store(fail)
+	switch {
+	case !fail:
+		log.Print("liveness failure cleared")
+	case d > 0:
+		log.Printf("failing liveness for %s", d)
+		var t *time.Timer
+		t = time.AfterFunc(d, func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.failTimer == t {
+				p.failingLiveness.Store(false)
+				p.failTimer = nil
+				log.Print("liveness failure expired")
+			}
+		})
+		p.failTimer = t
+	default:
+		log.Print("failing liveness until cleared")
+	}
+}
+
+// failLivenessHandler serves POST /admin/fail-liveness.
+func (p *probes) failLivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var f livenessFailure
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: "invalid liveness failure: " + err.Error()})
+			return
+		}
+		if f.DurationMillis < 0 {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: "duration_ms must not be negative"})
+			return
+		}
+		p.failLiveness(f.Fail, time.Duration(f.DurationMillis)*time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (p *probes) livenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.failingLiveness.Load() {
+			writeError(w, apiError{Code: http.StatusInternalServerError, Message: "liveness failure injected via /admin/fail-liveness"})
+			return
+		}
+		if age := time.Since(time.Unix(0, p.heartbeat.Load())); age > heartbeatTimeout {
+			writeError(w, apiError{Code: http.StatusServiceUnavailable, Message: fmt.Sprintf("last heartbeat %s ago", age.Round(time.Millisecond))})
+			return
+		}
+		writeResponse(w, "healthz", []byte("ok\n"))
+	})
+}
+
+func (p *probes) readinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case !p.started.Load():
+			writeError(w, apiError{Code: http.StatusServiceUnavailable, Message: "still starting"})
+		case p.draining.Load():
+			writeError(w, apiError{Code: http.StatusServiceUnavailable, Message: "draining"})
+		case p.maintenance != nil && p.maintenance.on.Load():
+			writeError(w, apiError{Code: http.StatusServiceUnavailable, Message: "down for maintenance"})
+		default:
+			writeResponse(w, "readyz", []byte("ready\n"))
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbes(t *testing.T) {
+	p := &probes{}
+	p.heartbeat.Store(time.Now().UnixNano())
+	check := func(stage string, startup, liveness, readiness int) {
+		t.Helper()
+		for _, tc := range []struct {
+			name string
+			h    http.Handler
+			code int
+		}{
+			{"/startupz", p.startupHandler(), startup},
+			{"/healthz", p.livenessHandler(), liveness},
+			{"/readyz", p.readinessHandler(), readiness},
+		} {
+			if rec := serve(tc.h, http.MethodGet, tc.name); rec.Code != tc.code {
+				t.Errorf("%s: %s answered %d, want %d", stage, tc.name, rec.Code, tc.code)
+			}
+		}
+	}
+
+	check("starting", http.StatusServiceUnavailable, http.StatusOK, http.StatusServiceUnavailable)
+	p.started.Store(true)
+	check("started", http.StatusOK, http.StatusOK, http.StatusOK)
+	p.draining.Store(true)
+	check("draining", http.StatusOK, http.StatusOK, http.StatusServiceUnavailable)
+	p.heartbeat.Store(time.Now().Add(-2 * heartbeatTimeout).UnixNano())
+	check("stuck", http.StatusOK, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+}
+
+func TestFailLiveness(t *testing.T) {
+	p := &probes{}
+	p.heartbeat.Store(time.Now().UnixNano())
+	fail := func(body string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		p.failLivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/fail-liveness", strings.NewReader(body)))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("POST %s: got %d: %s", body, rec.Code, rec.Body)
+		}
+	}
+	liveness := func() int { return serve(p.livenessHandler(), http.MethodGet, "/healthz").Code }
+
+	fail(`{"fail": true}`)
+	if code := liveness(); code != http.StatusInternalServerError {
+		t.Errorf("after failing liveness: /healthz answered %d, want 500", code)
+	}
+	fail(`{"fail": false}`)
+	if code := liveness(); code != http.StatusOK {
+		t.Errorf("after clearing the failure: /healthz answered %d, want 200", code)
+	}
+
+	fail(`{"fail": true, "duration_ms": 20}`)
+	if code := liveness(); code != http.StatusInternalServerError {
+		t.Errorf("during a timed failure: /healthz answered %d, want 500", code)
+	}
+	deadline := time.Now().Add(time.Second)
+	for liveness() != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("/healthz still failing a second after a 20ms failure")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	p.failLivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/fail-liveness", strings.NewReader(`{"fail": true, "duration_ms": -1}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("negative duration: got %d, want 400", rec.Code)
+	}
+}
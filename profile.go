@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"runtime/pprof"
+	"sync"
+)
+
+// errProfileBusy is returned by startCPUProfile while another profile is
+// being recorded.
+var errProfileBusy = errors.New("another CPU profile is already being recorded")
+
+// profileMu ensures only one CPU profile is recorded at a time, which the
+// runtime requires.
+var profileMu sync.Mutex
+
+// startCPUProfile starts recording a CPU profile of the whole process to a new
+// temporary file. The returned stop function ends the recording and returns
+// the path of the file.
+func startCPUProfile() (stop func() (string, error), err error) {
+	if !profileMu.TryLock() {
+		return nil, errProfileBusy
+	}
+	f, err := os.CreateTemp("", "hash-*.pprof")
+	if err != nil {
+		profileMu.Unlock()
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		profileMu.Unlock()
+		return nil, err
+	}
+	return func() (string, error) {
+		defer profileMu.Unlock()
+		pprof.StopCPUProfile()
+		return f.Name(), f.Close()
+	}, nil
+}
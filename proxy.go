@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// newOutboundClient returns the HTTP client used for requests the app makes
+// itself, instrumented with the http_client_* metrics. It does not follow
+// redirects, so a redirect cannot lead it to a host that was not allowed.
+func newOutboundClient(timeout time.Duration) *http.Client {
+	var transport http.RoundTripper = http.DefaultTransport.(*http.Transport).Clone()
+	transport = promhttp.InstrumentRoundTripperDuration(httpClientRequestDuration, transport)
+	transport = promhttp.InstrumentRoundTripperCounter(httpClientRequestsTotal, transport)
+	transport = promhttp.InstrumentRoundTripperInFlight(httpClientRequestsInFlight, transport)
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// newProxyHandler returns the handler for /proxy?url=..., which fetches url
+// with client and streams the response back with its status code and content
+// type. Only hosts on allowlist may be fetched, matched like
+// -dns-lookup-allow, so the endpoint cannot reach arbitrary services.
+func newProxyHandler(client *http.Client, allowlist []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, err := url.Parse(r.URL.Query().Get("url"))
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: "url must be an absolute http or https URL"})
+			return
+		}
+		host := strings.ToLower(target.Hostname())
+		if !hostAllowed(host, allowlist) {
+			writeError(w, apiError{Code: http.StatusForbidden, Message: "host " + host + " is not in -proxy-allow"})
+			return
+		}
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target.String(), nil)
+		if err != nil {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			if r.Context().Err() != nil {
+				return // the client went away, nobody is left to answer
+			}
+			writeError(w, apiError{Code: http.StatusBadGateway, Message: err.Error()})
+			return
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		if loc := resp.Header.Get("Location"); loc != "" {
+			w.Header().Set("Location", loc)
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/x-teapot")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+	defer target.Close()
+	h := newProxyHandler(newOutboundClient(time.Second), []string{"127.0.0.1"})
+
+	outbound := httpClientRequestsTotal.WithLabelValues("418", "get")
+	before := testutil.ToFloat64(outbound)
+	rec := serve(h, http.MethodGet, "/proxy?url="+url.QueryEscape(target.URL+"/pot"))
+	if rec.Code != http.StatusTeapot || rec.Body.String() != "short and stout" {
+		t.Errorf("got %d %q, want the target's status and body", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/x-teapot" {
+		t.Errorf("Content-Type = %q, want the target's", ct)
+	}
+	if got := testutil.ToFloat64(outbound) - before; got != 1 {
+		t.Errorf("http_client_requests_total increased by %v, want 1", got)
+	}
+
+	for target, code := range map[string]int{
+		"http://example.com/": http.StatusForbidden,
+		"file:///etc/passwd":  http.StatusBadRequest,
+		"/relative":           http.StatusBadRequest,
+	} {
+		if rec := serve(h, http.MethodGet, "/proxy?url="+url.QueryEscape(target)); rec.Code != code {
+			t.Errorf("%s: got %d, want %d", target, rec.Code, code)
+		}
+	}
+}
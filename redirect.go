@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// newRedirectHandler returns the handler for /redirect/{code}/{location...},
+// which redirects with the given 3xx status, 302 by default, to the given
+// path on this server, / by default. Only local paths are accepted so that the
+// endpoint cannot be abused as an open redirect.
+func newRedirectHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := http.StatusFound
+		if s := r.PathValue("code"); s != "" {
+			var err error
+			code, err = strconv.Atoi(s)
+			if err != nil || code < 300 || code > 399 {
+				writeError(w, apiError{Code: http.StatusBadRequest, Message: "code must be a redirect status between 300 and 399"})
+				return
+			}
+		}
+		location := r.PathValue("location")
+		if strings.ContainsRune(location, '\\') {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: "location must be a path on this server"})
+			return
+		}
+		// Cleaning after prefixing collapses leading slashes, so that e.g.
+		// //example.com cannot turn into a protocol-relative URL.
+		http.Redirect(w, r, path.Clean("/"+location), code)
+	})
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	h := newRedirectHandler()
+	mux.Handle("/redirect/{code}/{location...}", h)
+	mux.Handle("/redirect/{code}", h)
+	mux.Handle("/redirect", h)
+	for _, tc := range []struct {
+		target   string
+		code     int
+		location string
+	}{
+		{"/redirect", http.StatusFound, "/"},
+		{"/redirect/301", http.StatusMovedPermanently, "/"},
+		{"/redirect/307/wait/1", http.StatusTemporaryRedirect, "/wait/1"},
+	} {
+		rec := serve(mux, http.MethodGet, tc.target)
+		if rec.Code != tc.code || rec.Header().Get("Location") != tc.location {
+			t.Errorf("%s: got %d to %q, want %d to %q", tc.target, rec.Code, rec.Header().Get("Location"), tc.code, tc.location)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxReplayCalls bounds the number of internal requests one /replay may make.
+// Each call is still subject to the limits of the endpoint it hits.
+const maxReplayCalls = 100
+
+// replaySpec is the body of POST /replay.
+type replaySpec struct {
+	Steps []replayStep `json:"steps"`
+}
+
+// replayStep requests Path Repeat times, once if Repeat is 0.
+type replayStep struct {
+	Path   string `json:"path"`
+	Repeat int    `json:"repeat"`
+}
+
+// replayCall is one entry of the timeline returned by /replay.
+type replayCall struct {
+	Step            int     `json:"step"`
+	Path            string  `json:"path"`
+	Status          int     `json:"status"`
+	StartSeconds    float64 `json:"start_seconds"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// newReplayHandler returns the handler for POST /replay, which runs the GET
+// requests described by a replaySpec against h one after the other, and
+// returns when each started and how it went. That scripts a load pattern,
+// such as "hash three times, then wait", without an external driver. main
+// passes the app's outermost handler as h, so the calls go through the same
+// routes, instrumentation, in-flight limits and access log as external
+// requests.
+func newReplayHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var spec replaySpec
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&spec); err != nil {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: "invalid replay spec: " + err.Error()})
+			return
+		}
+		calls := 0
+		for i, step := range spec.Steps {
+			if !strings.HasPrefix(step.Path, "/") || strings.HasPrefix(step.Path, "//") {
+				writeError(w, apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("step %d: path must be a local path", i)})
+				return
+			}
+			if p := strings.SplitN(step.Path, "?", 2)[0]; p == "/replay" || strings.HasPrefix(p, "/admin/") {
+				writeError(w, apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("step %d: %s cannot be replayed", i, p)})
+				return
+			}
+			if step.Repeat < 0 {
+				writeError(w, apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("step %d: repeat must not be negative", i)})
+				return
+			}
+			calls += max(step.Repeat, 1)
+		}
+		if calls > maxReplayCalls {
+			writeError(w, apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("a replay may make at most %d calls", maxReplayCalls)})
+			return
+		}
+
+		ctx := r.Context()
+		start := time.Now()
+		timeline := make([]replayCall, 0, calls)
+		for i, step := range spec.Steps {
+			for range max(step.Repeat, 1) {
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, step.Path, nil)
+				if err != nil {
+					writeError(w, apiError{Code: http.StatusBadRequest, Message: fmt.Sprintf("step %d: %v", i, err)})
+					return
+				}
+				req.RemoteAddr, req.Proto, req.ProtoMajor, req.ProtoMinor = r.RemoteAddr, r.Proto, r.ProtoMajor, r.ProtoMinor
+				callStart := time.Now()
+				rec := &bufferedWriter{header: http.Header{}, status: http.StatusOK}
+				h.ServeHTTP(rec, req)
+				if ctx.Err() != nil {
+					return // the client went away, nobody is left to answer
+				}
+				timeline = append(timeline, replayCall{
+					Step:            i,
+					Path:            step.Path,
+					Status:          rec.status,
+					StartSeconds:    callStart.Sub(start).Seconds(),
+					DurationSeconds: time.Since(callStart).Seconds(),
+				})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(timeline)
+	})
+}
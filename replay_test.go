@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	var served []string
+	mux := http.NewServeMux()
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = append(served, r.URL.Path)
+	}))
+	replay := func(spec string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		newReplayHandler(mux).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/replay", strings.NewReader(spec)))
+		return rec
+	}
+
+	rec := replay(`{"steps": [{"path": "/hash/1", "repeat": 2}, {"path": "/wait/1"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var timeline []replayCall
+	if err := json.Unmarshal(rec.Body.Bytes(), &timeline); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/hash/1", "/hash/1", "/wait/1"}
+	if !slices.Equal(served, want) {
+		t.Errorf("served %v, want %v", served, want)
+	}
+	if len(timeline) != len(want) {
+		t.Fatalf("got %d timeline entries, want %d", len(timeline), len(want))
+	}
+	for i, call := range timeline {
+		if call.Path != want[i] || call.Status != http.StatusOK || (i > 0 && call.StartSeconds < timeline[i-1].StartSeconds) {
+			t.Errorf("timeline entry %d = %+v, want %s after the previous one", i, call, want[i])
+		}
+	}
+	if timeline[2].Step != 1 {
+		t.Errorf("the last call belongs to step %d, want 1", timeline[2].Step)
+	}
+
+	for _, spec := range []string{
+		`{"steps": [{"path": "/admin/maintenance"}]}`,
+		`{"steps": [{"path": "/replay"}]}`,
+		`{"steps": [{"path": "http://example.com/"}]}`,
+		`{"steps": [{"path": "/", "repeat": 101}]}`,
+	} {
+		if rec := replay(spec); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", spec, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// trackRequestRate samples httpRequestsTotal every window until ctx is done,
+// and sets httpRequestsRate to the requests per second over the last window.
+// It duplicates what rate() does in PromQL, for quick looks at /metrics
+// without a Prometheus server.
+func trackRequestRate(ctx context.Context, window time.Duration) {
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	last, lastTime := counterSum(httpRequestsTotal), time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			total := counterSum(httpRequestsTotal)
+			httpRequestsRate.Set((total - last) / now.Sub(lastTime).Seconds())
+			last, lastTime = total, now
+		}
+	}
+}
+
+// counterSum adds up the values of every counter c collects.
+func counterSum(c prometheus.Collector) float64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	sum := 0.0
+	for m := range ch {
+		var pb dto.Metric
+		if m.Write(&pb) == nil && pb.Counter != nil {
+			sum += pb.Counter.GetValue()
+		}
+	}
+	return sum
+}
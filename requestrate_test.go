@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRequestRate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	httpRequestsRate.Set(0)
+	go trackRequestRate(ctx, 20*time.Millisecond)
+
+	inst := newTestInstrumenter()
+	h := inst.instrument("found", newFoundHandler("hello", "text/plain"))
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(httpRequestsRate) <= 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("http_requests_rate stayed at 0 under traffic")
+		}
+		serve(h, http.MethodGet, "/")
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "net/http"
+
+// addResponseHeaders adds headers to every response of next that does not
+// set them itself, and sets forced on every response whatever next did.
+func addResponseHeaders(headers, forced http.Header, next http.Handler) http.Handler {
+	if len(headers) == 0 && len(forced) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&headerWriter{ResponseWriter: w, headers: headers, forced: forced}, r)
+	})
+}
+
+// headerWriter applies the configured headers just before the response
+// headers are sent, when it is known which ones the handler set.
+type headerWriter struct {
+	http.ResponseWriter
+	headers, forced http.Header
+	wroteHeader     bool
+}
+
+func (w *headerWriter) apply() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	for key, values := range w.headers {
+		if _, ok := h[key]; !ok {
+			h[key] = values
+		}
+	}
+	for key, values := range w.forced {
+		h[key] = values
+	}
+}
+
+func (w *headerWriter) WriteHeader(code int) {
+	w.apply()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	w.apply()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *headerWriter) Flush() {
+	w.apply()
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *headerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
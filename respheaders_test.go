@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAddResponseHeaders(t *testing.T) {
+	headers, forced := headerFlag{}, headerFlag{}
+	for _, s := range []string{"X-Frame-Options:DENY", "Content-Type:text/html"} {
+		if err := headers.Set(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := forced.Set("Cache-Control: no-store"); err != nil {
+		t.Fatal(err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("hello"))
+	})
+	rec := serve(addResponseHeaders(http.Header(headers), http.Header(forced), next), http.MethodGet, "/")
+	for key, want := range map[string]string{
+		"X-Frame-Options": "DENY",       // added, the handler does not set it
+		"Content-Type":    "text/plain", // kept, the handler set it
+		"Cache-Control":   "no-store",   // forced over the handler's value
+	} {
+		if got := rec.Header().Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	if err := headers.Set("no-colon"); err == nil {
+		t.Error(`Set("no-colon") succeeded, want an error`)
+	}
+}
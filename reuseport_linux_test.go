@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestReusePort(t *testing.T) {
+	first, err := listen("tcp", "127.0.0.1:0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := listen("tcp", first.Addr().String(), true)
+	if err != nil {
+		t.Fatalf("binding %s a second time with SO_REUSEPORT: %v", first.Addr(), err)
+	}
+	second.Close()
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "syscall"
+
+// reusePortControl is a no-op outside Linux.
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return nil
+}
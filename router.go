@@ -0,0 +1,15 @@
+package main
+
+import "net/http"
+
+// router is what the app's routes are registered on. Patterns use the syntax
+// of http.ServeMux, which is also the default implementation; building with
+// -tags chi swaps in github.com/go-chi/chi for users who need its middleware
+// ordering or regexp routes. See newRouter.
+type router interface {
+	http.Handler
+	Handle(pattern string, handler http.Handler)
+	// allows reports whether a route other than the catch-all for
+	// unmatched paths serves r's path with method.
+	allows(r *http.Request, method string) bool
+}
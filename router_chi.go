@@ -0,0 +1,65 @@
+//go:build chi
+
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// chiRouter registers http.ServeMux patterns on a chi.Mux.
+type chiRouter struct {
+	*chi.Mux
+}
+
+// newRouter returns a chi router that understands the http.ServeMux patterns
+// the app registers its routes with.
+func newRouter() router {
+	return chiRouter{chi.NewRouter()}
+}
+
+// Handle translates pattern from http.ServeMux syntax into chi's: a leading
+// method restricts the route to that method, with GET also matching HEAD,
+// {$} anchors a trailing slash, a trailing slash otherwise matches the whole
+// subtree, and a {name...} wildcard is exposed under name via PathValue as it
+// is with ServeMux.
+//
+// Unlike ServeMux, chi does not redirect unclean paths or paths missing a
+// trailing slash.
+func (c chiRouter) Handle(pattern string, handler http.Handler) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = "", pattern
+	}
+	switch {
+	case strings.HasSuffix(path, "/{$}"):
+		path = strings.TrimSuffix(path, "{$}")
+	case strings.HasSuffix(path, "...}"):
+		i := strings.LastIndex(path, "{")
+		name := path[i+1 : len(path)-len("...}")]
+		path = path[:i] + "*"
+		next := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue(name, r.PathValue("*"))
+			next.ServeHTTP(w, r)
+		})
+	case strings.HasSuffix(path, "/"):
+		path += "*"
+	}
+	if method == "" {
+		c.Mux.Handle(path, handler)
+		return
+	}
+	c.Mux.Method(method, path, handler)
+	if method == http.MethodGet {
+		c.Mux.Method(http.MethodHead, path, handler)
+	}
+}
+
+func (c chiRouter) allows(r *http.Request, method string) bool {
+	rctx := chi.NewRouteContext()
+	// Paths that no route serves fall through to the /* catch-all.
+	return c.Mux.Match(rctx, method, r.URL.Path) && rctx.RoutePattern() != "/*"
+}
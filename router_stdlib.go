@@ -0,0 +1,24 @@
+//go:build !chi
+
+package main
+
+import "net/http"
+
+// serveMux is the standard library's http.ServeMux.
+type serveMux struct {
+	*http.ServeMux
+}
+
+// newRouter returns the standard library's http.ServeMux.
+func newRouter() router {
+	return serveMux{http.NewServeMux()}
+}
+
+func (m serveMux) allows(r *http.Request, method string) bool {
+	probe := r.Clone(r.Context())
+	probe.Method = method
+	// Paths that no route serves fall through to the "/" catch-all, and an
+	// empty pattern means a 405 or a redirect instead of a route.
+	_, pattern := m.Handler(probe)
+	return pattern != "" && pattern != "/"
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// serve serves a request for target with method from h and returns the
+// recorded response.
+func serve(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+func TestUnmatchedRoute(t *testing.T) {
+	inst := newTestInstrumenter()
+	mux := newRouter()
+	mux.Handle("/{$}", inst.instrument("found", newFoundHandler("hello", "text/plain")))
+	mux.Handle("/", inst.instrument(unmatchedHandler, unmatchedRoute))
+
+	unmatched := httpRequestsTotal.WithLabelValues("404", "get", "HTTP/1.1", "false")
+	before := testutil.ToFloat64(unmatched)
+	if rec := serve(mux, http.MethodGet, "/random"); rec.Code != http.StatusNotFound {
+		t.Errorf("/random: got %d, want 404", rec.Code)
+	}
+	if got := testutil.ToFloat64(unmatched) - before; got != 1 {
+		t.Errorf("http_requests_total{route_matched=\"false\"} increased by %v, want 1", got)
+	}
+	if rec := serve(mux, http.MethodGet, "/"); rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Errorf("/: got %d %q, want the greeting", rec.Code, rec.Body)
+	}
+}
+
+func TestRouterPatterns(t *testing.T) {
+	mux := newRouter()
+	for _, pattern := range []string{"/{$}", "/", "/wait/{waitSec}", "/redirect/{code}/{location...}", "/static/", "POST /replay"} {
+		mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(pattern + " " + r.PathValue("waitSec") + r.PathValue("location")))
+		}))
+	}
+	for _, tc := range []struct {
+		method, target, body string
+	}{
+		{http.MethodGet, "/", "/{$} "},
+		{http.MethodGet, "/nope", "/ "},
+		{http.MethodGet, "/wait/3", "/wait/{waitSec} 3"},
+		{http.MethodGet, "/wait/3/4", "/ "},
+		{http.MethodGet, "/redirect/302/a/b", "/redirect/{code}/{location...} a/b"},
+		{http.MethodGet, "/static/css/app.css", "/static/ "},
+		{http.MethodPost, "/replay", "POST /replay "},
+	} {
+		if rec := serve(mux, tc.method, tc.target); rec.Body.String() != tc.body {
+			t.Errorf("%s %s: got %d %q, want %q", tc.method, tc.target, rec.Code, rec.Body, tc.body)
+		}
+	}
+	for _, tc := range []struct {
+		target, method string
+		allowed        bool
+	}{
+		{"/replay", http.MethodPost, true},
+		{"/replay", http.MethodGet, false},
+		{"/wait/3", http.MethodGet, true},
+		{"/nope", http.MethodGet, false},
+	} {
+		if got := mux.allows(httptest.NewRequest(http.MethodOptions, tc.target, nil), tc.method); got != tc.allowed {
+			t.Errorf("allows(%s, %s) = %t, want %t", tc.target, tc.method, got, tc.allowed)
+		}
+	}
+}
+
+func TestTrailingSlashRoutes(t *testing.T) {
+	mux := newRouter()
+	mux.Handle("/", unmatchedRoute)
+	for _, p := range waitPatterns {
+		mux.Handle(p, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("waitSec=" + r.PathValue("waitSec")))
+		}))
+	}
+	for _, tc := range []struct {
+		target string
+		code   int
+		body   string
+	}{
+		{"/wait", http.StatusOK, "waitSec="},
+		{"/wait/", http.StatusOK, "waitSec="},
+		{"/wait/5", http.StatusOK, "waitSec=5"},
+		{"/wait/5/", http.StatusOK, "waitSec=5"},
+		{"/wait/5/6", http.StatusNotFound, ""},
+	} {
+		rec := serve(mux, http.MethodGet, tc.target)
+		if rec.Code != tc.code || (tc.body != "" && rec.Body.String() != tc.body) {
+			t.Errorf("%s: got %d %q, want %d %q", tc.target, rec.Code, rec.Body, tc.code, tc.body)
+		}
+	}
+}
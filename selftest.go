@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// hashVector is a known SHA-256 digest of a fixed input.
+type hashVector struct {
+	name   string
+	input  []byte
+	digest string
+}
+
+// hashVectors are checked by /selftest/hash. Their sizes are multiples of the
+// 1KB chunks hashRandomData reads.
+var hashVectors = []hashVector{
+	{"1KB of zero bytes", make([]byte, 1024), "5f70bf18a086007016e948b04aed3b82103a36bea41755b6cddfaf10ace3c6ef"},
+	{"1MB of the letter a", bytes.Repeat([]byte("a"), 1024*1024), "9bc1b2a288b26af7257a36277ae3816a7d4f16e89c1e7e77d0a5c48bad62b360"},
+}
+
+// hashSelftestResult reports the outcome for one of hashVectors.
+type hashSelftestResult struct {
+	Name     string `json:"name"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Pass     bool   `json:"pass"`
+}
+
+// newHashSelftestHandler returns the handler for /selftest/hash, which runs
+// hashVectors through hashRandomData, the same code /hash uses, and reports
+// whether every digest matched. It answers 500 if any did not.
+func newHashSelftestHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pass := true
+		results := make([]hashSelftestResult, 0, len(hashVectors))
+		for _, v := range hashVectors {
+			digest, _, err := hashRandomData(r.Context(), bytes.NewReader(v.input), len(v.input))
+			if err != nil {
+				return // the client went away, nobody is left to answer
+			}
+			results = append(results, hashSelftestResult{Name: v.name, Expected: v.digest, Actual: digest, Pass: digest == v.digest})
+			pass = pass && digest == v.digest
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !pass {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(struct {
+			Pass    bool                 `json:"pass"`
+			Results []hashSelftestResult `json:"results"`
+		}{pass, results})
+	})
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestHashSelftest(t *testing.T) {
+	for _, v := range hashVectors {
+		sum := sha256.Sum256(v.input)
+		if got := hex.EncodeToString(sum[:]); got != v.digest {
+			t.Errorf("%s: crypto/sha256 gives %s, but the vector expects %s", v.name, got, v.digest)
+		}
+	}
+
+	rec := serve(newHashSelftestHandler(), http.MethodGet, "/selftest/hash")
+	var body struct {
+		Pass    bool                 `json:"pass"`
+		Results []hashSelftestResult `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || !body.Pass || len(body.Results) != len(hashVectors) {
+		t.Errorf("got %d %+v, want every vector to pass", rec.Code, body)
+	}
+}
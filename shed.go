@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// inFlight is the number of requests currently being served. It backs the
+// http_requests_in_flight gauge and is what the load shedder compares against
+// -max-inflight.
+var inFlight atomic.Int64
+
+// trackInFlight counts the requests being served by next in inFlight, and
+// those arriving as HTTP/2 streams, over h2c or TLS, in http2_active_streams.
+func trackInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+		if r.ProtoMajor == 2 {
+			http2ActiveStreams.Inc()
+			defer http2ActiveStreams.Dec()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// shedLoad protects the process from a storm of expensive requests by
+// rejecting them with 503 while more than maxInFlight requests are in flight.
+// Only expensive handlers are wrapped, so cheap endpoints keep answering. A
+// maxInFlight of 0 disables shedding.
+func shedLoad(handler string, maxInFlight int, next http.Handler) http.Handler {
+	if maxInFlight <= 0 {
+		return next
+	}
+	shed := httpRequestsShedTotal.WithLabelValues(handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inFlight.Load() > int64(maxInFlight) {
+			shed.Inc()
+			w.Header().Set("Retry-After", "1")
+			writeError(w, apiError{
+				Code:    http.StatusServiceUnavailable,
+				Message: "too many requests in flight, try again later",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestShedLoad(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux := http.NewServeMux()
+	mux.Handle("/cheap", ok)
+	mux.Handle("/expensive", shedLoad("expensive", 2, ok))
+	h := trackInFlight(mux)
+
+	inFlight.Store(2)
+	defer inFlight.Store(0)
+	shed := testutil.ToFloat64(httpRequestsShedTotal.WithLabelValues("expensive"))
+	for path, want := range map[string]int{"/cheap": http.StatusOK, "/expensive": http.StatusServiceUnavailable} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("%s with the in-flight limit reached: got %d, want %d", path, rec.Code, want)
+		}
+	}
+	if got := testutil.ToFloat64(httpRequestsShedTotal.WithLabelValues("expensive")) - shed; got != 1 {
+		t.Errorf("http_requests_shed_total increased by %v, want 1", got)
+	}
+
+	inFlight.Store(0)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/expensive", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/expensive below the in-flight limit: got %d, want 200", rec.Code)
+	}
+}
+
+func TestHTTP2ActiveStreams(t *testing.T) {
+	const streams = 3
+	arrived, release := make(chan struct{}), make(chan struct{})
+	ts := httptest.NewUnstartedServer(trackInFlight(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	})))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	before := testutil.ToFloat64(http2ActiveStreams)
+	done := make(chan error, streams)
+	for range streams {
+		go func() {
+			resp, err := ts.Client().Get(ts.URL)
+			if err == nil {
+				resp.Body.Close()
+				if resp.ProtoMajor != 2 {
+					t.Errorf("got a %s response, want HTTP/2", resp.Proto)
+				}
+			}
+			done <- err
+		}()
+	}
+	for range streams {
+		<-arrived
+	}
+	if got := testutil.ToFloat64(http2ActiveStreams) - before; got != streams {
+		t.Errorf("with %d streams open, http2_active_streams rose by %v", streams, got)
+	}
+	close(release)
+	for range streams {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := testutil.ToFloat64(http2ActiveStreams) - before; got != 0 {
+		t.Errorf("after the streams finished, http2_active_streams is %v above where it started", got)
+	}
+}
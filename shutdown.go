@@ -0,0 +1,17 @@
+package main
+
+import "sync"
+
+var (
+	// shuttingDown is closed by beginShutdown. Long-running handlers select on
+	// it so that a graceful shutdown does not have to wait for them to finish
+	// on their own.
+	shuttingDown     = make(chan struct{})
+	shuttingDownOnce sync.Once
+)
+
+// beginShutdown signals long-running handlers to wrap up. It is registered
+// with http.Server.RegisterOnShutdown when -shutdown-drain-connections is set.
+func beginShutdown() {
+	shuttingDownOnce.Do(func() { close(shuttingDown) })
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// testShutdown gives the test its own shuttingDown channel, and returns the
+// function that closes it in place of beginShutdown, whose sync.Once would
+// only let one test run close the channel. The open channel is put back when
+// the test is done so that other tests are unaffected.
+func testShutdown(t *testing.T) func() {
+	open, ch := shuttingDown, make(chan struct{})
+	shuttingDown = ch
+	t.Cleanup(func() { shuttingDown = open })
+	return func() { close(ch) }
+}
+
+func TestShutdownDrainConnections(t *testing.T) {
+	begin := testShutdown(t)
+	mux := http.NewServeMux()
+	mux.Handle("/wait/{waitSec}", newWaitHandler(1))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: mux}
+	srv.RegisterOnShutdown(begin)
+	go srv.Serve(ln)
+
+	start := time.Now()
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/wait/30")
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	time.Sleep(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown did not complete: %v", err)
+	}
+	if code := <-status; code != http.StatusServiceUnavailable {
+		t.Errorf("the in-flight /wait answered %d, want 503", code)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the in-flight /wait took %s to finish after shutdown began", elapsed)
+	}
+}
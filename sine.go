@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// simulateSine sets demo_sine to amplitude * sin(2π t / period), with t the
+// time since the call, every interval until ctx is done. A smooth, predictable
+// wave makes it easy to practise dashboard panels and alert thresholds.
+func simulateSine(ctx context.Context, period time.Duration, amplitude float64, interval time.Duration) {
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		phase := 2 * math.Pi * float64(time.Since(start)) / float64(period)
+		demoSine.Set(amplitude * math.Sin(phase))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
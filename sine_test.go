@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSimulateSine(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Now()
+	go simulateSine(ctx, time.Second, 10, 5*time.Millisecond)
+
+	// A quarter period in the wave is at its crest, three quarters in at its
+	// trough.
+	for _, tc := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{250 * time.Millisecond, 10},
+		{750 * time.Millisecond, -10},
+	} {
+		time.Sleep(time.Until(start.Add(tc.at)))
+		if got := testutil.ToFloat64(demoSine); math.Abs(got-tc.want) > 3 {
+			t.Errorf("demo_sine at %s = %v, want about %v", tc.at, got, tc.want)
+		}
+	}
+}
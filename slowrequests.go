@@ -0,0 +1,98 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// slowRequest is one entry of /admin/slow-requests.
+type slowRequest struct {
+	Time            time.Time `json:"time"`
+	Handler         string    `json:"handler"`
+	Method          string    `json:"method"`
+	Path            string    `json:"path"`
+	Status          int       `json:"status"`
+	DurationSeconds float64   `json:"duration_seconds"`
+}
+
+// slowRequestLog keeps the slowest requests that took at least threshold, to
+// show where tail latency comes from without a tracing backend. The entries
+// form a min-heap on duration, bounded to its capacity, so a new request
+// only displaces the fastest one kept and only if it was slower.
+type slowRequestLog struct {
+	threshold time.Duration
+	mu        sync.Mutex
+	entries   slowRequestHeap
+}
+
+// newSlowRequestLog returns a log of the size slowest requests. A size of 0
+// disables the log and returns nil.
+func newSlowRequestLog(size int, threshold time.Duration) *slowRequestLog {
+	if size <= 0 {
+		return nil
+	}
+	return &slowRequestLog{threshold: threshold, entries: make(slowRequestHeap, 0, size)}
+}
+
+func (l *slowRequestLog) add(e slowRequest) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) < cap(l.entries) {
+		heap.Push(&l.entries, e)
+		return
+	}
+	if e.DurationSeconds > l.entries[0].DurationSeconds {
+		l.entries[0] = e
+		heap.Fix(&l.entries, 0)
+	}
+}
+
+// slowRequestHeap implements heap.Interface with the fastest request first.
+type slowRequestHeap []slowRequest
+
+func (h slowRequestHeap) Len() int           { return len(h) }
+func (h slowRequestHeap) Less(i, j int) bool { return h[i].DurationSeconds < h[j].DurationSeconds }
+func (h slowRequestHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *slowRequestHeap) Push(x any)        { *h = append(*h, x.(slowRequest)) }
+func (h *slowRequestHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// wrap records the requests to the handler registered as name that are slow
+// enough. A nil log records nothing.
+func (l *slowRequestLog) wrap(name string, h http.Handler) http.Handler {
+	if l == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		if d := time.Since(start); d >= l.threshold {
+			l.add(slowRequest{Time: start, Handler: name, Method: r.Method, Path: r.URL.Path, Status: sw.status, DurationSeconds: d.Seconds()})
+		}
+	})
+}
+
+// adminHandler serves GET /admin/slow-requests, listing the recorded
+// requests slowest first.
+func (l *slowRequestLog) adminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		entries := append([]slowRequest{}, l.entries...)
+		l.mu.Unlock()
+		sort.Slice(entries, func(i, j int) bool { return entries[i].DurationSeconds > entries[j].DurationSeconds })
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			ThresholdSeconds float64       `json:"threshold_seconds"`
+			Requests         []slowRequest `json:"requests"`
+		}{l.threshold.Seconds(), entries})
+	})
+}
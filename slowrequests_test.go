@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSlowRequests(t *testing.T) {
+	inst := newTestInstrumenter()
+	inst.slow = newSlowRequestLog(2, 500*time.Millisecond)
+	mux := http.NewServeMux()
+	mux.Handle("/wait/{waitSec}", inst.instrument("wait", newWaitHandler(1)))
+	mux.Handle("/{$}", inst.instrument("found", newFoundHandler("hello", "text/plain")))
+	serve(mux, http.MethodGet, "/wait/1")
+	serve(mux, http.MethodGet, "/")
+
+	rec := serve(inst.slow.adminHandler(), http.MethodGet, "/admin/slow-requests")
+	var list struct {
+		ThresholdSeconds float64       `json:"threshold_seconds"`
+		Requests         []slowRequest `json:"requests"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("body %q: %v", rec.Body, err)
+	}
+	if list.ThresholdSeconds != 0.5 {
+		t.Errorf("threshold_seconds = %v, want 0.5", list.ThresholdSeconds)
+	}
+	if len(list.Requests) != 1 {
+		t.Fatalf("listed %+v, want only the slow /wait", list.Requests)
+	}
+	if r := list.Requests[0]; r.Handler != "wait" || r.Method != http.MethodGet || r.Path != "/wait/1" || r.Status != http.StatusOK || r.DurationSeconds < 1 {
+		t.Errorf("listed %+v, want the 1s GET /wait/1 that answered 200", r)
+	}
+}
+
+func TestSlowRequestLogKeepsSlowest(t *testing.T) {
+	l := newSlowRequestLog(2, 0)
+	for _, e := range []slowRequest{
+		{Path: "/slowest", DurationSeconds: 3},
+		{Path: "/slow", DurationSeconds: 2},
+		{Path: "/faster", DurationSeconds: 1}, // later, but must not evict either
+		{Path: "/slower", DurationSeconds: 2.5},
+	} {
+		l.add(e)
+	}
+	rec := serve(l.adminHandler(), http.MethodGet, "/admin/slow-requests")
+	var list struct {
+		Requests []slowRequest `json:"requests"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, r := range list.Requests {
+		paths = append(paths, r.Path)
+	}
+	if len(paths) != 2 || paths[0] != "/slowest" || paths[1] != "/slower" {
+		t.Errorf("listed %v, want /slowest and /slower, slowest first", paths)
+	}
+	if newSlowRequestLog(0, 0) != nil {
+		t.Error("a size of 0 returned a log, want nil")
+	}
+}
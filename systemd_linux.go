@@ -0,0 +1,55 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// systemdListenFDsStart is the first file descriptor passed by systemd.
+const systemdListenFDsStart = 3
+
+// systemdListeners returns the listening sockets passed by systemd socket
+// activation, following the LISTEN_PID and LISTEN_FDS protocol of
+// sd_listen_fds(3). The variables are unset afterwards so that child
+// processes do not mistake the sockets for their own.
+func systemdListeners() ([]net.Listener, error) {
+	pid, fds, names := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid == "" || fds == "" {
+		return nil, errors.New("LISTEN_PID and LISTEN_FDS are not set; is the app started by a systemd socket unit?")
+	}
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, fmt.Errorf("LISTEN_PID is %s, but this process is %d", pid, os.Getpid())
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("LISTEN_FDS must be a positive number, not %q", fds)
+	}
+	fdNames := strings.Split(names, ":")
+	var listeners []net.Listener
+	for i := range n {
+		fd := systemdListenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "systemd-socket-" + strconv.Itoa(fd)
+		if i < len(fdNames) && fdNames[i] != "" {
+			name = fdNames[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(f)
+		f.Close() // FileListener works on a duplicate
+		if err != nil {
+			return nil, fmt.Errorf("file descriptor %d (%s) is not a listening socket: %w", fd, name, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestSystemdListeners passes a listening socket to a child test process the
+// way systemd does, as file descriptor 3 with LISTEN_FDS set, and checks that
+// the child serves on it.
+func TestSystemdListeners(t *testing.T) {
+	if os.Getenv("SYSTEMD_SOCKET_TEST_CHILD") == "1" {
+		// systemd sets LISTEN_PID after forking, which exec.Cmd cannot do.
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		listeners, err := systemdListeners()
+		if err != nil || len(listeners) != 1 {
+			t.Fatalf("got %d listeners: %v", len(listeners), err)
+		}
+		conn, err := listeners[0].Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte(listeners[0].Addr().String()))
+		conn.Close()
+		return
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSystemdListeners$")
+	cmd.Env = append(os.Environ(), "SYSTEMD_SOCKET_TEST_CHILD=1", "LISTEN_FDS=1")
+	cmd.ExtraFiles = []*os.File{f}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go io.Copy(io.Discard, out)
+
+	conn, err := net.DialTimeout("tcp", ln.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	got, _ := io.ReadAll(conn)
+	conn.Close()
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("child: %v", err)
+	}
+	if string(got) != ln.Addr().String() {
+		t.Errorf("child answered %q, want the address of the socket it was passed, %s", got, ln.Addr())
+	}
+}
+
+func TestSystemdListenersEnvironment(t *testing.T) {
+	for _, env := range [][2]string{{"", ""}, {"1", "1"}} {
+		t.Setenv("LISTEN_PID", env[0])
+		t.Setenv("LISTEN_FDS", env[1])
+		if _, err := systemdListeners(); err == nil {
+			t.Errorf("LISTEN_PID=%q LISTEN_FDS=%q: got listeners, want an error", env[0], env[1])
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// systemdListeners always fails outside Linux, where there is no systemd.
+func systemdListeners() ([]net.Listener, error) {
+	return nil, errors.New("systemd socket activation is only supported on Linux")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader provides the certificate in certFile and keyFile to TLS
+// handshakes. It checks the files' modification times on every handshake and
+// reloads them when they change, so rotating the certificate on disk does not
+// require a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// newCertReloader loads the certificate once up front, so that a bad path or
+// key pair fails at startup rather than on the first handshake.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.GetCertificate(nil); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return r.fallback(err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return r.fallback(err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cert != nil && certInfo.ModTime().Equal(r.certMod) && keyInfo.ModTime().Equal(r.keyMod) {
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			// Most likely the files are mid-rotation; keep serving the
+			// previous certificate and try again on the next handshake.
+			log.Printf("failed to reload TLS certificate, serving the previous one: %v", err)
+			return r.cert, nil
+		}
+		return nil, err
+	}
+	r.cert, r.certMod, r.keyMod = &cert, certInfo.ModTime(), keyInfo.ModTime()
+	log.Printf("loaded TLS certificate from %s", r.certFile)
+	return r.cert, nil
+}
+
+// fallback keeps serving the last loaded certificate when the files cannot be
+// inspected, and reports err if there is none yet.
+func (r *certReloader) fallback(err error) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cert == nil {
+		return nil, err
+	}
+	log.Printf("failed to check TLS certificate for changes, serving the previous one: %v", err)
+	return r.cert, nil
+}
+
+// observeHandshakes records how long server-side TLS handshakes on config take
+// in tls_handshake_duration_seconds. The clock starts when the ClientHello has
+// been read, in GetConfigForClient, and stops when the handshake has been
+// verified, in VerifyConnection. Handshakes that fail are not observed.
+func observeHandshakes(config *tls.Config) {
+	// Initialise the session ticket keys before config is cloned, so the
+	// clones share them and sessions can still be resumed.
+	// See https://github.com/golang/go/issues/60506.
+	config.DecryptTicket(nil, tls.ConnectionState{})
+	base := config.Clone()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		start := time.Now()
+		c := base.Clone()
+		c.VerifyConnection = func(tls.ConnectionState) error {
+			tlsHandshakeDuration.Observe(time.Since(start).Seconds())
+			return nil
+		}
+		return c, nil
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// servedCommonName returns the common name of the certificate served by a TLS
+// listener using config in a fresh handshake.
+func servedCommonName(t *testing.T, config *tls.Config) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.(*tls.Conn).Handshake()
+		conn.Close()
+	}()
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestCertReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "first")
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &tls.Config{GetCertificate: certs.GetCertificate}
+	if cn := servedCommonName(t, config); cn != "first" {
+		t.Fatalf("served %q, want the first certificate", cn)
+	}
+
+	writeTestCert(t, dir, "second")
+	// Make sure the rotation is visible even on coarse file system clocks.
+	later := time.Now().Add(time.Minute)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cn := servedCommonName(t, config); cn != "second" {
+		t.Errorf("served %q after rotating the files, want the second certificate", cn)
+	}
+}
+
+func TestHandshakeDuration(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "localhost")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	observeHandshakes(config)
+	ts := httptest.NewUnstartedServer(newFoundHandler("hello", "text/plain"))
+	ts.TLS = config
+	ts.StartTLS()
+	defer ts.Close()
+
+	before := histogramOf(t, tlsHandshakeDuration).GetSampleCount()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := histogramOf(t, tlsHandshakeDuration).GetSampleCount() - before; n != 1 {
+		t.Errorf("tls_handshake_duration_seconds observed %d handshakes, want 1", n)
+	}
+}
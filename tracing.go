@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startOTLPTraceExport returns a tracer provider that batches spans and
+// pushes them to an OTLP/HTTP endpoint.
+func startOTLPTraceExport(ctx context.Context, endpoint string) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter)), nil
+}
+
+// newTraceTestHandler returns the handler for /trace-test, which records a
+// fixed tree of spans: a parent with two children, the second of which
+// carries an event and an error status. It exists to check that a tracing
+// backend shows hierarchies and errors as expected, and answers 501 without
+// recording anything when tracing is disabled, that is when tp is nil.
+func newTraceTestHandler(tp trace.TracerProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tp == nil {
+			writeError(w, apiError{Code: http.StatusNotImplemented, Message: "tracing is disabled, set -otlp-traces-endpoint to enable it"})
+			return
+		}
+		tracer := tp.Tracer("github.com/brancz/prometheus-example-app")
+		ctx, parent := tracer.Start(r.Context(), "trace-test")
+		_, first := tracer.Start(ctx, "trace-test/child-ok")
+		time.Sleep(time.Millisecond)
+		first.End()
+		_, second := tracer.Start(ctx, "trace-test/child-error")
+		second.AddEvent("failure injected", trace.WithAttributes(attribute.String("reason", "requested by /trace-test")))
+		err := errors.New("error requested by /trace-test")
+		second.RecordError(err)
+		second.SetStatus(codes.Error, err.Error())
+		second.End()
+		parent.End()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			TraceID string `json:"trace_id"`
+			Spans   int    `json:"spans"`
+		}{parent.SpanContext().TraceID().String(), 3})
+	})
+}
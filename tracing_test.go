@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceTest(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	rec := serve(newTraceTestHandler(tp), http.MethodGet, "/trace-test")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var res struct {
+		TraceID string `json:"trace_id"`
+		Spans   int    `json:"spans"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	spans := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = s
+	}
+	if len(spans) != 3 || res.Spans != 3 {
+		t.Fatalf("recorded %d spans and reported %d, want 3", len(spans), res.Spans)
+	}
+	parent, ok := spans["trace-test"]
+	if !ok || parent.Parent.IsValid() || parent.SpanContext.TraceID().String() != res.TraceID {
+		t.Fatalf("got parent %+v, want a root span in trace %s", parent, res.TraceID)
+	}
+	for _, name := range []string{"trace-test/child-ok", "trace-test/child-error"} {
+		if got := spans[name].Parent.SpanID(); got != parent.SpanContext.SpanID() {
+			t.Errorf("%s has parent %s, want %s", name, got, parent.SpanContext.SpanID())
+		}
+	}
+	if s := spans["trace-test/child-ok"]; s.Status.Code == codes.Error || len(s.Events) != 0 {
+		t.Errorf("child-ok has status %v and %d events, want neither an error nor events", s.Status.Code, len(s.Events))
+	}
+	failed := spans["trace-test/child-error"]
+	if failed.Status.Code != codes.Error {
+		t.Errorf("child-error has status %v, want Error", failed.Status.Code)
+	}
+	var injected bool
+	for _, e := range failed.Events {
+		injected = injected || e.Name == "failure injected"
+	}
+	if !injected {
+		t.Errorf("child-error has events %+v, want the injected failure", failed.Events)
+	}
+}
+
+func TestTraceTestDisabled(t *testing.T) {
+	if rec := serve(newTraceTestHandler(nil), http.MethodGet, "/trace-test"); rec.Code != http.StatusNotImplemented {
+		t.Errorf("without a tracer provider: got %d, want 501", rec.Code)
+	}
+}
+
+func TestOTLPTraceExport(t *testing.T) {
+	received := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		select {
+		case received <- body:
+		default:
+		}
+	}))
+	defer receiver.Close()
+
+	ctx := context.Background()
+	tp, err := startOTLPTraceExport(ctx, receiver.URL+"/v1/traces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve(newTraceTestHandler(tp), http.MethodGet, "/trace-test")
+	// Shutting down flushes the batched spans.
+	if err := tp.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case body := <-received:
+		if !bytes.Contains(body, []byte("trace-test/child-error")) {
+			t.Errorf("the export does not contain the trace-test spans")
+		}
+	default:
+		t.Fatal("nothing was exported")
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// userAgentClasses are the only values of the user_agent label, keeping
+// http_requests_by_agent_total bounded however many clients show up.
+var userAgentClasses = []string{"browser", "curl", "prometheus", "other"}
+
+// userAgentClass sorts a User-Agent header into one of userAgentClasses.
+func userAgentClass(ua string) string {
+	ua = strings.ToLower(ua)
+	switch {
+	case strings.HasPrefix(ua, "prometheus/"):
+		return "prometheus"
+	case strings.HasPrefix(ua, "curl/"):
+		return "curl"
+	case strings.HasPrefix(ua, "mozilla/"):
+		// Every mainstream browser still starts its User-Agent with
+		// Mozilla/5.0, as do some bots, which is fine for a coarse split.
+		return "browser"
+	default:
+		return "other"
+	}
+}
+
+// countUserAgents counts every request in http_requests_by_agent_total by the
+// class of its User-Agent.
+func countUserAgents(next http.Handler) http.Handler {
+	for _, class := range userAgentClasses {
+		httpRequestsByAgentTotal.WithLabelValues(class)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpRequestsByAgentTotal.WithLabelValues(userAgentClass(r.UserAgent())).Inc()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCountUserAgents(t *testing.T) {
+	h := countUserAgents(newFoundHandler("hello", "text/plain"))
+	for _, tc := range []struct {
+		ua, class string
+	}{
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0", "browser"},
+		{"curl/8.10.1", "curl"},
+		{"Prometheus/2.55.0", "prometheus"},
+		{"Go-http-client/1.1", "other"},
+		{"", "other"},
+	} {
+		counter := httpRequestsByAgentTotal.WithLabelValues(tc.class)
+		before := testutil.ToFloat64(counter)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("User-Agent", tc.ua)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if got := testutil.ToFloat64(counter) - before; got != 1 {
+			t.Errorf("User-Agent %q: http_requests_by_agent_total{user_agent=%q} increased by %v, want 1", tc.ua, tc.class, got)
+		}
+	}
+	if n := testutil.CollectAndCount(httpRequestsByAgentTotal); n != len(userAgentClasses) {
+		t.Errorf("http_requests_by_agent_total has %d series, want one per class", n)
+	}
+}
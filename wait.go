@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// waitPatterns are the routes of the wait handler. Every form of the path,
+// with or without a trailing slash, is registered explicitly. That keeps
+// ServeMux from redirecting /wait to /wait/, and keeps a subtree pattern from
+// swallowing paths such as /wait/3/ with the default arguments. Anything
+// deeper is a 404.
+var waitPatterns = []string{"GET /wait", "GET /wait/{$}", "GET /wait/{waitSec}", "GET /wait/{waitSec}/{$}"}
+
+// newWaitHandler returns the handler for /wait/{waitSec}, waiting defaultSec
+// seconds when waitSec is missing or invalid. The wait ends early if the
+// client cancels the request or the server starts shutting down, and the
+// time actually waited is recorded either way.
+func newWaitHandler(defaultSec int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		waitSec, _ := strconv.Atoi(r.PathValue("waitSec"))
+		if waitSec < 1 {
+			waitSec = defaultSec // errors, no value, and negative values all get the default
+		}
+		waitRequested.Observe(float64(waitSec))
+
+		start := time.Now()
+		timer := time.NewTimer(time.Duration(waitSec) * time.Second)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			waitDuration.WithLabelValues("completed").Observe(time.Since(start).Seconds())
+		case <-r.Context().Done():
+			waitDuration.WithLabelValues("cancelled").Observe(time.Since(start).Seconds())
+			return
+		case <-shuttingDown:
+			waitDuration.WithLabelValues("shutdown").Observe(time.Since(start).Seconds())
+			writeError(w, apiError{Code: http.StatusServiceUnavailable, Message: "server is shutting down"})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		writeResponse(w, "wait", []byte("Waited for "+strconv.Itoa(waitSec)+" seconds."))
+	})
+}
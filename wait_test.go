@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// histogramOf returns the current state of the histogram o.
+func histogramOf(t *testing.T, o prometheus.Observer) *dto.Histogram {
+	t.Helper()
+	var m dto.Metric
+	if err := o.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram()
+}
+
+// serveWait serves target from a wait handler defaulting to defaultSec,
+// routed like main routes /wait.
+func serveWait(ctx context.Context, defaultSec int, target string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	for _, p := range waitPatterns {
+		mux.Handle(p, newWaitHandler(defaultSec))
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequestWithContext(ctx, http.MethodGet, target, nil))
+	return rec
+}
+
+func TestWaitCancelled(t *testing.T) {
+	before := histogramOf(t, waitDuration.WithLabelValues("cancelled"))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	serveWait(ctx, 1, "/wait/3")
+	after := histogramOf(t, waitDuration.WithLabelValues("cancelled"))
+	if n := after.GetSampleCount() - before.GetSampleCount(); n != 1 {
+		t.Fatalf("recorded %d cancelled waits, want 1", n)
+	}
+	if waited := after.GetSampleSum() - before.GetSampleSum(); waited >= 3 {
+		t.Errorf("recorded a cancelled wait of %vs, want less than the 3s requested", waited)
+	}
+}
+
+func TestWaitRequested(t *testing.T) {
+	// The requested duration is observed before waiting, so cancelled
+	// requests record it without the test having to wait 10s.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	before := histogramOf(t, waitRequested)
+	serveWait(ctx, 1, "/wait/3")
+	serveWait(ctx, 1, "/wait/7")
+	after := histogramOf(t, waitRequested)
+	if n := after.GetSampleCount() - before.GetSampleCount(); n != 2 {
+		t.Fatalf("observed %d requested waits, want 2", n)
+	}
+	if sum := after.GetSampleSum() - before.GetSampleSum(); sum != 10 {
+		t.Errorf("requested waits sum to %vs, want 3s + 7s", sum)
+	}
+	// 3 lands in the le=4 bucket and 7 in the le=8 one.
+	for i, b := range after.GetBucket() {
+		want := uint64(0)
+		switch le := b.GetUpperBound(); {
+		case le >= 8:
+			want = 2
+		case le >= 4:
+			want = 1
+		}
+		if got := b.GetCumulativeCount() - before.GetBucket()[i].GetCumulativeCount(); got != want {
+			t.Errorf("bucket le=%v gained %d observations, want %d", b.GetUpperBound(), got, want)
+		}
+	}
+}
+
+func TestWaitDefault(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	before := histogramOf(t, waitRequested)
+	for _, target := range []string{"/wait", "/wait/", "/wait/abc", "/wait/-1"} {
+		serveWait(ctx, 2, target)
+	}
+	after := histogramOf(t, waitRequested)
+	if sum := after.GetSampleSum() - before.GetSampleSum(); sum != 8 {
+		t.Errorf("requested waits sum to %vs, want the 2s default four times", sum)
+	}
+}
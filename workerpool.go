@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+)
+
+// workerPool runs the expensive handlers on a fixed number of goroutines
+// shared by all of them, bounding the expensive work in progress across
+// endpoints. Requests wait in a queue of bounded length for a free worker,
+// and are rejected with 503 when the queue is full.
+type workerPool struct {
+	jobs chan poolJob
+}
+
+// poolJob is one request handed to a worker. done is closed once the worker
+// has finished with the request, carrying any panic along.
+type poolJob struct {
+	run  func()
+	done chan any
+}
+
+// newWorkerPool starts size workers with a queue of queueLen requests. A size
+// of 0 disables the pool and returns nil.
+func newWorkerPool(size, queueLen int) *workerPool {
+	if size <= 0 {
+		return nil
+	}
+	p := &workerPool{jobs: make(chan poolJob, max(queueLen, 0))}
+	for range size {
+		go p.work()
+	}
+	return p
+}
+
+func (p *workerPool) work() {
+	for job := range p.jobs {
+		workerPoolQueueDepth.Dec()
+		workerPoolActive.Inc()
+		func() {
+			defer func() {
+				job.done <- recover()
+			}()
+			job.run()
+		}()
+		workerPoolActive.Dec()
+	}
+}
+
+// wrap runs next on a worker of the pool, rejecting the request with 503 if
+// the queue is full. A nil pool runs next directly.
+func (p *workerPool) wrap(next http.Handler) http.Handler {
+	if p == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		job := poolJob{
+			run: func() {
+				if r.Context().Err() != nil {
+					return // the client gave up while the request was queued
+				}
+				next.ServeHTTP(w, r)
+			},
+			done: make(chan any, 1),
+		}
+		workerPoolQueueDepth.Inc()
+		select {
+		case p.jobs <- job:
+		default:
+			workerPoolQueueDepth.Dec()
+			w.Header().Set("Retry-After", "1")
+			writeError(w, apiError{
+				Code:    http.StatusServiceUnavailable,
+				Message: "worker pool queue is full, try again later",
+			})
+			return
+		}
+		// The worker writes to w, so wait for it even if the client has
+		// gone away, and re-raise its panics where they can be recovered.
+		if v := <-job.done; v != nil {
+			panic(v)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWorkerPool(t *testing.T) {
+	arrived, release := make(chan struct{}, 2), make(chan struct{})
+	h := newWorkerPool(1, 1).wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	depth, active := testutil.ToFloat64(workerPoolQueueDepth), testutil.ToFloat64(workerPoolActive)
+
+	results := make(chan int, 2)
+	request := func() { results <- serve(h, http.MethodGet, "/hash").Code }
+	go request()
+	<-arrived // the only worker is busy
+	go request()
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(workerPoolQueueDepth)-depth != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("the second request was not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := testutil.ToFloat64(workerPoolActive) - active; got != 1 {
+		t.Errorf("worker_pool_active rose by %v with the worker busy, want 1", got)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hash", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("with the queue full: got %d, want 503 with Retry-After", rec.Code)
+	}
+
+	close(release)
+	for range 2 {
+		if code := <-results; code != http.StatusOK {
+			t.Errorf("a queued request got %d, want 200", code)
+		}
+	}
+	// The worker marks itself idle just after handing the response back.
+	deadline = time.Now().Add(time.Second)
+	for testutil.ToFloat64(workerPoolQueueDepth) != depth || testutil.ToFloat64(workerPoolActive) != active {
+		if time.Now().After(deadline) {
+			t.Fatal("the queue depth and active workers did not return to where they started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// writeResponse writes b to w on behalf of handler. A client that went away
+// mid-write is an expected event for the long-running handlers, so it is
+// counted in http_client_disconnects_total rather than treated as a failure.
+func writeResponse(w http.ResponseWriter, handler string, b []byte) {
+	if _, err := w.Write(b); err != nil && isClientGone(err) {
+		httpClientDisconnectsTotal.WithLabelValues(handler).Inc()
+	}
+}
+
+// isClientGone reports whether err from writing a response means the client
+// closed or reset the connection.
+func isClientGone(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// acceptsJSON reports whether the client listed application/json in its
+// Accept header, in which case handlers answer with JSON instead of prose.
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accept); err == nil && mediaType == "application/json" {
+			return true
+		}
+	}
+	return false
+}
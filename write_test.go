@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestClientDisconnect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/payload/{bytes}", newPayloadHandler(1<<30))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	disconnects := httpClientDisconnectsTotal.WithLabelValues("payload")
+	before := testutil.ToFloat64(disconnects)
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "GET /payload/%d HTTP/1.1\r\nHost: test\r\n\r\n", 1<<30)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.CopyN(io.Discard, resp.Body, 64*1024)
+	conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(disconnects) == before {
+		if time.Now().After(deadline) {
+			t.Fatal("http_client_disconnects_total did not increase after the client went away mid-stream")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}